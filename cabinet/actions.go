@@ -0,0 +1,217 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"fmt"
+)
+
+type ActionKind uint8
+
+const (
+	ACTION_UNKNOWN ActionKind = iota
+
+	ACTION_NODE_CREATE
+	ACTION_NODE_UPDATE
+	ACTION_NODE_DELETE
+
+	ACTION_EDGE_UPDATE
+	ACTION_EDGE_DELETE
+	ACTION_EDGE_CLEAR
+
+	ACTION_INDEX_CREATE
+	ACTION_INDEX_DELETE
+
+	ACTION_META_UPDATE
+	ACTION_META_DELETE
+	ACTION_META_CLEAR
+
+	ACTION_COUNTER_REGISTER
+	ACTION_COUNTER_INCREMENT
+	ACTION_COUNTER_DELETE
+
+	ACTION_READ_CHECK
+)
+
+var actionKindNames = map[ActionKind]string{
+	ACTION_UNKNOWN:           "Unknown",
+	ACTION_NODE_CREATE:       "NodeCreate",
+	ACTION_NODE_UPDATE:       "NodeUpdate",
+	ACTION_NODE_DELETE:       "NodeDelete",
+	ACTION_EDGE_UPDATE:       "EdgeUpdate",
+	ACTION_EDGE_DELETE:       "EdgeDelete",
+	ACTION_EDGE_CLEAR:        "EdgeClear",
+	ACTION_INDEX_CREATE:      "IndexCreate",
+	ACTION_INDEX_DELETE:      "IndexDelete",
+	ACTION_META_UPDATE:       "MetaUpdate",
+	ACTION_META_DELETE:       "MetaDelete",
+	ACTION_META_CLEAR:        "MetaClear",
+	ACTION_COUNTER_REGISTER:  "CounterRegister",
+	ACTION_COUNTER_INCREMENT: "CounterIncrement",
+	ACTION_COUNTER_DELETE:    "CounterDelete",
+	ACTION_READ_CHECK:        "ReadCheck",
+}
+
+func (k ActionKind) String() string {
+	if name, known := actionKindNames[k]; known {
+		return name
+	}
+
+	return fmt.Sprintf("ActionKind(%d)", uint8(k))
+}
+
+func KindOf(o *pb.TransactionAction) ActionKind {
+	if o == nil {
+		return ACTION_UNKNOWN
+	}
+
+	switch o.Action.(type) {
+	case *pb.TransactionAction_NodeCreate:
+		return ACTION_NODE_CREATE
+	case *pb.TransactionAction_NodeUpdate:
+		return ACTION_NODE_UPDATE
+	case *pb.TransactionAction_NodeDelete:
+		return ACTION_NODE_DELETE
+	case *pb.TransactionAction_EdgeUpdate:
+		return ACTION_EDGE_UPDATE
+	case *pb.TransactionAction_EdgeDelete:
+		return ACTION_EDGE_DELETE
+	case *pb.TransactionAction_EdgeClear:
+		return ACTION_EDGE_CLEAR
+	case *pb.TransactionAction_IndexCreate:
+		return ACTION_INDEX_CREATE
+	case *pb.TransactionAction_IndexDelete:
+		return ACTION_INDEX_DELETE
+	case *pb.TransactionAction_MetaUpdate:
+		return ACTION_META_UPDATE
+	case *pb.TransactionAction_MetaDelete:
+		return ACTION_META_DELETE
+	case *pb.TransactionAction_MetaClear:
+		return ACTION_META_CLEAR
+	case *pb.TransactionAction_CounterRegister:
+		return ACTION_COUNTER_REGISTER
+	case *pb.TransactionAction_CounterIncrement:
+		return ACTION_COUNTER_INCREMENT
+	case *pb.TransactionAction_CounterDelete:
+		return ACTION_COUNTER_DELETE
+	case *pb.TransactionAction_ReadCheck:
+		return ACTION_READ_CHECK
+	default:
+		return ACTION_UNKNOWN
+	}
+}
+
+// ActionHandle points to a queued action; returned by O() and the typed builders
+type ActionHandle struct {
+	trx *Transaction
+	id  uint32
+}
+
+func (h *ActionHandle) ID() uint32 {
+	return h.id
+}
+
+func (h *ActionHandle) Action() *pb.TransactionAction {
+	return h.trx.actions[h.id]
+}
+
+func (h *ActionHandle) Kind() ActionKind {
+	return KindOf(h.Action())
+}
+
+// TmpID is the temporary node ID introduced by a NodeCreate, empty for every other action
+func (h *ActionHandle) TmpID() string {
+	return h.trx.tmpMap[h.id]
+}
+
+// NodeID is the real node ID once committed, otherwise the temporary one
+func (h *ActionHandle) NodeID() string {
+	tmpID := h.TmpID()
+
+	if tmpID == "" {
+		if nc, isCreate := h.Action().GetAction().(*pb.TransactionAction_NodeCreate); isCreate {
+			return nc.NodeCreate.Id
+		}
+
+		return ""
+	}
+
+	h.trx.mapMux.Lock()
+	defer h.trx.mapMux.Unlock()
+
+	if realID, mapped := h.trx.idMap[tmpID]; mapped {
+		return realID
+	}
+
+	return tmpID
+}
+
+// NodeCreate queues n; an empty n.Id is replaced with "tmp:<ActionId>"
+func (c *Transaction) NodeCreate(n *pb.Node) *ActionHandle {
+	if n.Id == "" {
+		n.Id = fmt.Sprintf("%s%d", TMP_ID_PREFIX, c.actPos)
+	}
+
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_NodeCreate{NodeCreate: n}})
+}
+
+func (c *Transaction) NodeUpdate(n *pb.Node) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_NodeUpdate{NodeUpdate: n}})
+}
+
+func (c *Transaction) NodeDelete(n *pb.Node) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_NodeDelete{NodeDelete: n}})
+}
+
+func (c *Transaction) EdgeUpdate(e *pb.Edge) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_EdgeUpdate{EdgeUpdate: e}})
+}
+
+func (c *Transaction) EdgeDelete(e *pb.Edge) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_EdgeDelete{EdgeDelete: e}})
+}
+
+func (c *Transaction) EdgeClear(e *pb.Edge) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_EdgeClear{EdgeClear: e}})
+}
+
+func (c *Transaction) IndexCreate(i *pb.Index) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_IndexCreate{IndexCreate: i}})
+}
+
+func (c *Transaction) IndexDelete(i *pb.Index) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_IndexDelete{IndexDelete: i}})
+}
+
+func (c *Transaction) MetaUpdate(m *pb.Meta) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_MetaUpdate{MetaUpdate: m}})
+}
+
+func (c *Transaction) MetaDelete(m *pb.Meta) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_MetaDelete{MetaDelete: m}})
+}
+
+func (c *Transaction) MetaClear(m *pb.Meta) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_MetaClear{MetaClear: m}})
+}
+
+func (c *Transaction) CounterRegister(s *pb.Counter) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_CounterRegister{CounterRegister: s}})
+}
+
+func (c *Transaction) CounterIncrement(s *pb.Counter) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_CounterIncrement{CounterIncrement: s}})
+}
+
+func (c *Transaction) CounterDelete(s *pb.Counter) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_CounterDelete{CounterDelete: s}})
+}
+
+func (c *Transaction) ReadCheck(r *pb.ReadCheckRequest) *ActionHandle {
+	return c.O(&pb.TransactionAction{Action: &pb.TransactionAction_ReadCheck{ReadCheck: r}})
+}
@@ -0,0 +1,96 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet/iri"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+)
+
+var ErrWildcard = errors.New("wildcard IRI")
+
+// Get reads the object an IRI names: a *pb.Node, *pb.Edge, *pb.Index, *pb.Meta or *pb.Counter. Wildcard IRIs
+// name several objects and are rejected with ErrWildcard.
+func Get(ctx context.Context, cli pb.CDSCabinetClient, address string) (proto.Message, error) {
+	object, err := iri.Parse(address)
+
+	if err != nil {
+		return nil, err
+	} else if object.Wildcard() {
+		return nil, fmt.Errorf("%w %q: cannot get several objects", ErrWildcard, address)
+	}
+
+	var found proto.Message
+
+	switch o := object.(type) {
+	case iri.Node:
+		found, err = cli.NodeGet(ctx, &pb.NodeGetRequest{NodeType: o.Type, Id: o.Id})
+	case iri.Edge:
+		found, err = cli.EdgeGet(ctx, &pb.EdgeGetRequest{Edge: o.Proto()})
+	case iri.Index:
+		found, err = cli.IndexGet(ctx, &pb.IndexGetRequest{Index: o.Proto()})
+	case iri.NodeMeta:
+		found, err = cli.MetaGet(ctx, o.Proto())
+	case iri.EdgeMeta:
+		found, err = cli.MetaGet(ctx, o.Proto())
+	case iri.NodeCounter:
+		found, err = cli.CounterGet(ctx, o.Proto())
+	case iri.EdgeCounter:
+		found, err = cli.CounterGet(ctx, o.Proto())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// DeleteAction builds the action deleting the object an IRI names; a wildcard edge or meta IRI becomes an
+// EdgeClear or MetaClear
+func DeleteAction(address string) (*pb.TransactionAction, error) {
+	object, err := iri.Parse(address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := object.(type) {
+	case iri.Node:
+		return &pb.TransactionAction{Action: &pb.TransactionAction_NodeDelete{NodeDelete: o.Proto()}}, nil
+	case iri.Edge:
+		if o.Wildcard() {
+			return &pb.TransactionAction{Action: &pb.TransactionAction_EdgeClear{EdgeClear: o.Proto()}}, nil
+		}
+
+		return &pb.TransactionAction{Action: &pb.TransactionAction_EdgeDelete{EdgeDelete: o.Proto()}}, nil
+	case iri.Index:
+		return &pb.TransactionAction{Action: &pb.TransactionAction_IndexDelete{IndexDelete: o.Proto()}}, nil
+	case iri.NodeMeta:
+		return metaDelete(o.Proto(), o.Wildcard()), nil
+	case iri.EdgeMeta:
+		return metaDelete(o.Proto(), o.Wildcard()), nil
+	case iri.NodeCounter:
+		return &pb.TransactionAction{Action: &pb.TransactionAction_CounterDelete{CounterDelete: o.Proto()}}, nil
+	case iri.EdgeCounter:
+		return &pb.TransactionAction{Action: &pb.TransactionAction_CounterDelete{CounterDelete: o.Proto()}}, nil
+	default:
+		return nil, fmt.Errorf("%w %q: cannot delete", iri.ErrMalformed, address)
+	}
+}
+
+func metaDelete(m *pb.Meta, clear bool) *pb.TransactionAction {
+	if clear {
+		return &pb.TransactionAction{Action: &pb.TransactionAction_MetaClear{MetaClear: m}}
+	}
+
+	return &pb.TransactionAction{Action: &pb.TransactionAction_MetaDelete{MetaDelete: m}}
+}
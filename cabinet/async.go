@@ -0,0 +1,52 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	"context"
+)
+
+// CommitFuture is the pending result of CommitAsync()
+type CommitFuture struct {
+	trx    *Transaction
+	done   chan struct{}
+	err    error
+	cancel context.CancelFunc
+}
+
+// CommitAsync commits in the background; the returned future must be waited on or cancelled
+func (c *Transaction) CommitAsync() *CommitFuture {
+	ctx, cancel := context.WithCancel(c.ctx)
+	f := &CommitFuture{trx: c, done: make(chan struct{}), cancel: cancel}
+
+	go func() {
+		defer cancel()
+
+		f.err = c.CommitContext(ctx)
+		close(f.done)
+	}()
+
+	return f
+}
+
+func (f *CommitFuture) Transaction() *Transaction {
+	return f.trx
+}
+
+func (f *CommitFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+func (f *CommitFuture) Wait() error {
+	<-f.done
+	return f.err
+}
+
+// Cancel aborts the commit; Wait() then returns once the stream is torn down
+func (f *CommitFuture) Cancel() {
+	f.cancel()
+}
@@ -0,0 +1,313 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"github.com/golang/protobuf/proto"
+	"sync"
+	"time"
+)
+
+var ErrBatcherClosed = errors.New("batcher is closed")
+
+// BatchPolicy decides when a Batcher commits; zero values disable a limit
+type BatchPolicy struct {
+	MaxActions  int
+	MaxBytes    int           // encoded size of the actions in one batch
+	Interval    time.Duration // longest an action waits before its batch is committed
+	MaxInFlight int           // concurrent commits; Add() blocks while a full batch waits for one, 1 when 0
+}
+
+func DefaultBatchPolicy() *BatchPolicy {
+	return &BatchPolicy{
+		MaxActions:  500,
+		Interval:    100 * time.Millisecond,
+		MaxInFlight: 2,
+	}
+}
+
+// pendingBatch is one transaction of the Batcher, open until it is flushed
+type pendingBatch struct {
+	trx   *Transaction
+	bytes int
+	timer *time.Timer
+	done  chan struct{}
+	err   error
+}
+
+// ActionFuture is the pending outcome of an action added to a Batcher
+type ActionFuture struct {
+	batch *pendingBatch
+	id    uint32
+}
+
+func (f *ActionFuture) Done() <-chan struct{} {
+	return f.batch.done
+}
+
+// Wait returns the commit error of the transaction the action landed in
+func (f *ActionFuture) Wait() error {
+	<-f.batch.done
+	return f.batch.err
+}
+
+// Result is the server response to the action once its transaction is committed
+func (f *ActionFuture) Result() *ActionResult {
+	return f.batch.trx.Result(f.id)
+}
+
+func (f *ActionFuture) Transaction() *Transaction {
+	return f.batch.trx
+}
+
+// Batcher groups actions added from any goroutine into transactions, committed in the background once a
+// batch reaches the size limits or its interval elapses. A batch is shared by every caller, so actions that
+// create or reference temporary IDs and read checks are rejected: they would bind to or guard the actions of
+// other callers.
+type Batcher struct {
+	policy BatchPolicy
+	hooks  []*Hooks
+	retry  *RetryPolicy
+
+	open     *pendingBatch
+	inFlight map[*pendingBatch]bool
+	slots    chan struct{}
+	closed   bool
+	mux      sync.Mutex
+
+	client pb.CDSCabinetClient
+	ctx    context.Context
+}
+
+func NewBatcher(ctx context.Context, cli pb.CDSCabinetClient, p *BatchPolicy) *Batcher {
+	if p == nil {
+		p = DefaultBatchPolicy()
+	}
+
+	slots := p.MaxInFlight
+
+	if slots < 1 {
+		slots = 1
+	}
+
+	return &Batcher{
+		policy:   *p,
+		inFlight: make(map[*pendingBatch]bool),
+		slots:    make(chan struct{}, slots),
+		client:   cli,
+		ctx:      ctx,
+	}
+}
+
+// Use registers hooks on every batch transaction; call it before adding actions
+func (b *Batcher) Use(hooks ...*Hooks) {
+	b.mux.Lock()
+	b.hooks = append(b.hooks, hooks...)
+	b.mux.Unlock()
+}
+
+// SetRetryPolicy sets the retry policy of every batch transaction; call it before adding actions
+func (b *Batcher) SetRetryPolicy(p *RetryPolicy) {
+	b.mux.Lock()
+	b.retry = p
+	b.mux.Unlock()
+}
+
+// Add queues an action in the open batch, committing the batch if the action fills it. An invalid action is
+// rejected with a *ValidationError and never reaches a batch shared with other callers.
+func (b *Batcher) Add(o *pb.TransactionAction) (*ActionFuture, error) {
+	b.mux.Lock()
+
+	if b.closed {
+		b.mux.Unlock()
+		return nil, ErrBatcherClosed
+	}
+
+	v := actionValidator{aID: 1}
+
+	if b.open != nil {
+		v.aID = b.open.trx.Pos()
+	}
+
+	v.action(o)
+	v.batched(o)
+
+	if len(v.problems) > 0 {
+		b.mux.Unlock()
+		return nil, &ValidationError{Problems: v.problems}
+	}
+
+	if b.open == nil {
+		b.open = b.newBatch()
+	}
+
+	batch := b.open
+	f := &ActionFuture{batch: batch, id: batch.trx.O(o).ID()}
+	batch.bytes += proto.Size(o)
+
+	var filled *pendingBatch
+
+	if b.full(batch) {
+		filled = b.detach()
+	}
+
+	b.mux.Unlock()
+	b.commit(filled)
+
+	return f, nil
+}
+
+// batched rejects actions that depend on the other actions of their transaction
+func (v *actionValidator) batched(o *pb.TransactionAction) {
+	if _, isCheck := o.Action.(*pb.TransactionAction_ReadCheck); isCheck {
+		v.fail("read checks cannot be batched")
+	}
+
+	if tmpID := createdTmpID(o); tmpID != "" {
+		v.fail("%s cannot be created in a batch", tmpID)
+	}
+
+	for _, ref := range nodeRefs(o) {
+		if IsTmpID(*ref) {
+			v.fail("%s cannot be referenced in a batch", *ref)
+		}
+	}
+}
+
+func (b *Batcher) newBatch() *pendingBatch {
+	trx := &Transaction{}
+	trx.Setup(b.ctx, b.client)
+	trx.Use(b.hooks...)
+	trx.SetRetryPolicy(b.retry)
+
+	batch := &pendingBatch{trx: trx, done: make(chan struct{})}
+
+	if b.policy.Interval > 0 {
+		batch.timer = time.AfterFunc(b.policy.Interval, func() {
+			b.mux.Lock()
+
+			if b.open != batch {
+				b.mux.Unlock()
+				return
+			}
+
+			b.detach()
+			b.mux.Unlock()
+			b.commit(batch)
+		})
+	}
+
+	return batch
+}
+
+func (b *Batcher) full(batch *pendingBatch) bool {
+	switch {
+	case b.policy.MaxActions > 0 && len(batch.trx.actionIDs) >= b.policy.MaxActions:
+		return true
+	case b.policy.MaxBytes > 0 && batch.bytes >= b.policy.MaxBytes:
+		return true
+	default:
+		return false
+	}
+}
+
+// detach closes the open batch and marks it in flight, returning nil when no batch is open; b.mux must be
+// held
+func (b *Batcher) detach() *pendingBatch {
+	batch := b.open
+
+	if batch == nil {
+		return nil
+	}
+
+	b.open = nil
+
+	if batch.timer != nil {
+		batch.timer.Stop()
+	}
+
+	b.inFlight[batch] = true
+
+	return batch
+}
+
+// commit waits for a free commit slot, then commits a detached batch in the background; b.mux must not be
+// held, so other callers keep adding actions while the slots are taken
+func (b *Batcher) commit(batch *pendingBatch) {
+	if batch == nil {
+		return
+	}
+
+	b.slots <- struct{}{}
+
+	go func() {
+		batch.err = batch.trx.Commit()
+		<-b.slots
+
+		b.mux.Lock()
+		delete(b.inFlight, batch)
+		b.mux.Unlock()
+
+		close(batch.done)
+	}()
+}
+
+// wait returns the joined errors of the batches being committed
+func (b *Batcher) wait() error {
+	b.mux.Lock()
+	batches := make([]*pendingBatch, 0, len(b.inFlight))
+
+	for batch := range b.inFlight {
+		batches = append(batches, batch)
+	}
+
+	b.mux.Unlock()
+
+	errs := make([]error, 0)
+
+	for _, batch := range batches {
+		<-batch.done
+
+		if batch.err != nil {
+			errs = append(errs, batch.err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Flush commits the open batch and waits for every batch being committed, returning their joined errors
+func (b *Batcher) Flush() error {
+	b.mux.Lock()
+	batch := b.detach()
+	b.mux.Unlock()
+
+	b.commit(batch)
+
+	return b.wait()
+}
+
+// Close flushes and stops accepting actions
+func (b *Batcher) Close() error {
+	b.mux.Lock()
+
+	if b.closed {
+		b.mux.Unlock()
+		return ErrBatcherClosed
+	}
+
+	b.closed = true
+	batch := b.detach()
+	b.mux.Unlock()
+
+	b.commit(batch)
+
+	return b.wait()
+}
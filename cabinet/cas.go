@@ -0,0 +1,178 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"time"
+)
+
+// guardEqual queues a ReadCheck that fails the transaction unless the object at iri holds expected
+func (c *Transaction) guardEqual(iri string, expected []byte) *ActionHandle {
+	return c.ReadCheck(&pb.ReadCheckRequest{
+		Source: iri, Operator: pb.CheckOperators_EQUAL, Target: &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: string(expected)}},
+	})
+}
+
+func (c *Transaction) compareAndSwap(expected []byte, o *pb.TransactionAction) *ActionHandle {
+	iri, _ := describeAction(o)
+	c.guardEqual(iri, expected)
+
+	return c.O(o)
+}
+
+// CompareAndSwapNode updates n only if its properties still are expected; the handle is the NodeUpdate
+func (c *Transaction) CompareAndSwapNode(expected []byte, n *pb.Node) *ActionHandle {
+	return c.compareAndSwap(expected, &pb.TransactionAction{Action: &pb.TransactionAction_NodeUpdate{NodeUpdate: n}})
+}
+
+func (c *Transaction) CompareAndSwapEdge(expected []byte, e *pb.Edge) *ActionHandle {
+	return c.compareAndSwap(expected, &pb.TransactionAction{Action: &pb.TransactionAction_EdgeUpdate{EdgeUpdate: e}})
+}
+
+func (c *Transaction) CompareAndSwapMeta(expected []byte, m *pb.Meta) *ActionHandle {
+	return c.compareAndSwap(expected, &pb.TransactionAction{Action: &pb.TransactionAction_MetaUpdate{MetaUpdate: m}})
+}
+
+// CompareAndSwapIndex rewrites the properties of an existing index entry with IndexCreate
+func (c *Transaction) CompareAndSwapIndex(expected []byte, i *pb.Index) *ActionHandle {
+	return c.compareAndSwap(expected, &pb.TransactionAction{Action: &pb.TransactionAction_IndexCreate{IndexCreate: i}})
+}
+
+// ModifyFunc computes the new payload from the current one; returning an error stops the loop
+type ModifyFunc func(current []byte) ([]byte, error)
+
+// DefaultModifyPolicy retries read checks rejected by concurrent writers; only E(0x013) is retried
+func DefaultModifyPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     500 * time.Millisecond,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+}
+
+// modify re-reads and re-applies fn until the compare-and-swap commits or p gives up
+func modify(ctx context.Context, cli pb.CDSCabinetClient, p *RetryPolicy, read func() ([]byte, error), swap func(trx *Transaction, current []byte) error) error {
+	if p == nil {
+		p = DefaultModifyPolicy()
+	}
+
+	for try := 1; ; try++ {
+		current, err := read()
+
+		if err != nil {
+			return Decode(err)
+		}
+
+		trx := &Transaction{}
+		trx.Setup(ctx, cli)
+
+		if err := swap(trx, current); err != nil {
+			return err
+		}
+
+		err = trx.Commit()
+
+		if err == nil || !errors.Is(err, ErrReadCheckFailed) || try >= p.MaxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(p.backoff(try + 1)):
+		}
+	}
+}
+
+// ModifyNode is a read-modify-write of the node's properties; n only needs Type and Id
+func ModifyNode(ctx context.Context, cli pb.CDSCabinetClient, n *pb.Node, fn ModifyFunc, p *RetryPolicy) error {
+	return modify(ctx, cli, p, func() ([]byte, error) {
+		current, err := cli.NodeGet(ctx, &pb.NodeGetRequest{NodeType: n.Type, Id: n.Id})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return current.Properties, nil
+	}, func(trx *Transaction, current []byte) error {
+		next, err := fn(current)
+
+		if err == nil {
+			trx.CompareAndSwapNode(current, &pb.Node{Type: n.Type, Id: n.Id, Properties: next})
+		}
+
+		return err
+	})
+}
+
+// ModifyEdge is a read-modify-write of the edge's properties; e only needs Subject, Predicate and Target
+func ModifyEdge(ctx context.Context, cli pb.CDSCabinetClient, e *pb.Edge, fn ModifyFunc, p *RetryPolicy) error {
+	return modify(ctx, cli, p, func() ([]byte, error) {
+		current, err := cli.EdgeGet(ctx, &pb.EdgeGetRequest{Edge: withoutEdgeProperties(e)})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return current.Properties, nil
+	}, func(trx *Transaction, current []byte) error {
+		next, err := fn(current)
+
+		if err == nil {
+			trx.CompareAndSwapEdge(current, &pb.Edge{Subject: e.Subject, Predicate: e.Predicate, Target: e.Target, Properties: next})
+		}
+
+		return err
+	})
+}
+
+// ModifyMeta is a read-modify-write of the meta value; m only needs Object and Key
+func ModifyMeta(ctx context.Context, cli pb.CDSCabinetClient, m *pb.Meta, fn ModifyFunc, p *RetryPolicy) error {
+	return modify(ctx, cli, p, func() ([]byte, error) {
+		current, err := cli.MetaGet(ctx, &pb.Meta{Object: m.Object, Key: m.Key})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return current.Val, nil
+	}, func(trx *Transaction, current []byte) error {
+		next, err := fn(current)
+
+		if err == nil {
+			trx.CompareAndSwapMeta(current, &pb.Meta{Object: m.Object, Key: m.Key, Val: next})
+		}
+
+		return err
+	})
+}
+
+// ModifyIndex is a read-modify-write of the index entry's properties; i only needs Type, Value and Node
+func ModifyIndex(ctx context.Context, cli pb.CDSCabinetClient, i *pb.Index, fn ModifyFunc, p *RetryPolicy) error {
+	return modify(ctx, cli, p, func() ([]byte, error) {
+		current, err := cli.IndexGet(ctx, &pb.IndexGetRequest{Index: withoutIndexProperties(i)})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return current.Properties, nil
+	}, func(trx *Transaction, current []byte) error {
+		next, err := fn(current)
+
+		if err == nil {
+			trx.CompareAndSwapIndex(current, &pb.Index{Type: i.Type, Value: i.Value, Node: i.Node, Properties: next})
+		}
+
+		return err
+	})
+}
@@ -0,0 +1,133 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet/iri"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"fmt"
+)
+
+// CheckBuilder starts a read check on the object an IRI names
+type CheckBuilder struct {
+	source string
+}
+
+// Condition is a read check ready to be run or queued; building it validated its IRIs
+type Condition struct {
+	req *pb.ReadCheckRequest
+	err error
+}
+
+// Check starts a condition on source, e.g. Check(iri.NodeOf(n).String()).Equals("...")
+func Check(source string) *CheckBuilder {
+	return &CheckBuilder{source: source}
+}
+
+func (b *CheckBuilder) build(operator pb.CheckOperators, target *pb.CheckTarget, exact bool) *Condition {
+	cond := &Condition{req: &pb.ReadCheckRequest{Source: b.source, Operator: operator, Target: target}}
+
+	if source, err := iri.Parse(b.source); err != nil {
+		cond.err = err
+	} else if exact && source.Wildcard() {
+		cond.err = fmt.Errorf("%w %q: %s needs a single object", ErrWildcard, b.source, operator)
+	} else if other := target.GetIri(); other != "" {
+		if object, err := iri.Parse(other); err != nil {
+			cond.err = err
+		} else if object.Wildcard() {
+			cond.err = fmt.Errorf("%w %q: %s needs a single object", ErrWildcard, other, operator)
+		}
+	}
+
+	return cond
+}
+
+func valueTarget(value string) *pb.CheckTarget {
+	return &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: value}}
+}
+
+func objectTarget(object string) *pb.CheckTarget {
+	return &pb.CheckTarget{Target: &pb.CheckTarget_Iri{Iri: object}}
+}
+
+func (b *CheckBuilder) Exists() *Condition {
+	return b.build(pb.CheckOperators_EXISTS, valueTarget(WILDCARD), false)
+}
+
+func (b *CheckBuilder) Touch() *Condition {
+	return b.build(pb.CheckOperators_TOUCH, valueTarget(WILDCARD), false)
+}
+
+// Equals holds when the payload of the source is value
+func (b *CheckBuilder) Equals(value string) *Condition {
+	return b.build(pb.CheckOperators_EQUAL, valueTarget(value), true)
+}
+
+// EqualsObject holds when the payloads of the source and the object are the same
+func (b *CheckBuilder) EqualsObject(object string) *Condition {
+	return b.build(pb.CheckOperators_EQUAL, objectTarget(object), true)
+}
+
+func (b *CheckBuilder) NotEquals(value string) *Condition {
+	return b.build(pb.CheckOperators_NOT_EQUAL, valueTarget(value), true)
+}
+
+func (b *CheckBuilder) NotEqualsObject(object string) *Condition {
+	return b.build(pb.CheckOperators_NOT_EQUAL, objectTarget(object), true)
+}
+
+// Err is the validation problem of the condition, nil when it is well formed
+func (cond *Condition) Err() error {
+	return cond.err
+}
+
+func (cond *Condition) Request() (*pb.ReadCheckRequest, error) {
+	if cond.err != nil {
+		return nil, cond.err
+	}
+
+	return cond.req, nil
+}
+
+func (cond *Condition) Action() (*pb.TransactionAction, error) {
+	if cond.err != nil {
+		return nil, cond.err
+	}
+
+	return &pb.TransactionAction{Action: &pb.TransactionAction_ReadCheck{ReadCheck: cond.req}}, nil
+}
+
+// Run evaluates the condition with the ReadCheck RPC
+func (cond *Condition) Run(ctx context.Context, cli pb.CDSCabinetClient) (bool, error) {
+	if cond.err != nil {
+		return false, cond.err
+	}
+
+	rc, err := cli.ReadCheck(ctx, cond.req)
+
+	if err != nil {
+		return false, err
+	}
+
+	return rc.Result, nil
+}
+
+// Require queues the condition; the transaction fails unless it holds. A malformed condition fails
+// validation.
+func (c *Transaction) Require(cond *Condition) *ActionHandle {
+	if cond.err != nil {
+		c.queueErr = append(c.queueErr, &TransactionError{
+			msg:      fmt.Sprintf("action %d: %v", c.actPos, cond.err),
+			class:    TRANSACTION_ERROR_VALIDATION,
+			actionId: c.actPos,
+			err:      cond.err,
+		})
+	}
+
+	return c.ReadCheck(cond.req)
+}
@@ -0,0 +1,167 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+)
+
+// ChunkPolicy splits a commit into several transaction streams; zero values disable a limit
+type ChunkPolicy struct {
+	MaxActions int
+	MaxBytes   int // encoded size of the actions in one chunk
+}
+
+type ChunkResult struct {
+	Index     int
+	ActionIDs []uint32
+	Bytes     int
+	Err       error // nil once committed
+	Committed bool
+}
+
+// ChunkError is returned when a chunk fails; the chunks listed in Committed are already applied
+type ChunkError struct {
+	Committed []int
+	Failed    int
+	Err       error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("chunk %d failed after %d committed chunk(s): %s", e.Failed, len(e.Committed), e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// SetChunking enables chunked commits. Temporary IDs created by earlier chunks are rewritten with their real
+// IDs before later chunks are sent, and a failed commit can be resumed: committed chunks are not sent again.
+// A ReadCheck is sent in the same chunk as the writes after it, up to the next ReadCheck.
+func (c *Transaction) SetChunking(p *ChunkPolicy) {
+	c.chunking = p
+}
+
+// Chunks reports the chunks of the last commit in send order
+func (c *Transaction) Chunks() []*ChunkResult {
+	return c.chunks
+}
+
+// chunkUnits groups ids into the units a chunk boundary may not cross: a ReadCheck, with the checks right
+// after it, and the writes it guards up to the next ReadCheck form one unit; any other action is a unit alone
+func (c *Transaction) chunkUnits(ids []uint32) [][]uint32 {
+	units := make([][]uint32, 0, len(ids))
+	guarded, writes := false, false
+
+	for _, aID := range ids {
+		isCheck := KindOf(c.actions[aID]) == ACTION_READ_CHECK
+
+		switch {
+		case isCheck && guarded && !writes:
+			units[len(units)-1] = append(units[len(units)-1], aID)
+		case isCheck:
+			units = append(units, []uint32{aID})
+			guarded, writes = true, false
+		case guarded:
+			units[len(units)-1] = append(units[len(units)-1], aID)
+			writes = true
+		default:
+			units = append(units, []uint32{aID})
+		}
+	}
+
+	return units
+}
+
+func (c *Transaction) unitSize(unit []uint32) int {
+	size := 0
+
+	for _, aID := range unit {
+		size += proto.Size(c.actions[aID])
+	}
+
+	return size
+}
+
+// chunkProblems reports the guarded units of ids that do not fit in one chunk, none when chunking is off
+func (c *Transaction) chunkProblems(ids []uint32) []*TransactionError {
+	problems := make([]*TransactionError, 0)
+
+	if c.chunking == nil {
+		return problems
+	}
+
+	for _, unit := range c.chunkUnits(ids) {
+		size := c.unitSize(unit)
+		tooMany := c.chunking.MaxActions > 0 && len(unit) > c.chunking.MaxActions
+		tooBig := c.chunking.MaxBytes > 0 && size > c.chunking.MaxBytes
+
+		if len(unit) > 1 && (tooMany || tooBig) {
+			problems = append(problems, &TransactionError{
+				msg:      fmt.Sprintf("action %d: read check guards %d action(s), %d bytes, more than one chunk holds", unit[0], len(unit), size),
+				class:    TRANSACTION_ERROR_VALIDATION,
+				actionId: unit[0],
+			})
+		}
+	}
+
+	return problems
+}
+
+// splitChunks groups ids in order, closing a chunk before it would exceed either limit. A ReadCheck is never
+// separated from the writes it guards; Validate() rejects a guarded unit that does not fit in one chunk.
+func (c *Transaction) splitChunks(ids []uint32) []*ChunkResult {
+	chunks := make([]*ChunkResult, 0)
+	current := &ChunkResult{Index: 0, ActionIDs: make([]uint32, 0)}
+
+	for _, unit := range c.chunkUnits(ids) {
+		size := c.unitSize(unit)
+		full := c.chunking.MaxActions > 0 && len(current.ActionIDs)+len(unit) > c.chunking.MaxActions
+		oversize := c.chunking.MaxBytes > 0 && current.Bytes+size > c.chunking.MaxBytes
+
+		if len(current.ActionIDs) > 0 && (full || oversize) {
+			chunks = append(chunks, current)
+			current = &ChunkResult{Index: len(chunks), ActionIDs: make([]uint32, 0)}
+		}
+
+		current.ActionIDs = append(current.ActionIDs, unit...)
+		current.Bytes += size
+	}
+
+	if len(current.ActionIDs) > 0 {
+		chunks = append(chunks, current)
+	}
+
+	return chunks
+}
+
+func (c *Transaction) commitChunks(ctx context.Context, order []uint32) error {
+	pending := make([]uint32, 0, len(order))
+
+	for _, aID := range order {
+		if !c.committed[aID] {
+			pending = append(pending, aID)
+		}
+	}
+
+	c.chunks = c.splitChunks(pending)
+	committed := make([]int, 0, len(c.chunks))
+
+	for _, chunk := range c.chunks {
+		if err := c.commitWithRetry(ctx, chunk.ActionIDs); err != nil {
+			chunk.Err = err
+			return &ChunkError{Committed: committed, Failed: chunk.Index, Err: err}
+		}
+
+		chunk.Committed = true
+		committed = append(committed, chunk.Index)
+	}
+
+	return nil
+}
@@ -0,0 +1,343 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"sync"
+)
+
+// Codec encodes the values stored in node, edge and index properties and in meta values. Msgpack and CBOR
+// codecs live in the cabinet/codecs package, so only programs that import it depend on their encoder.
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	JSONCodec     Codec = jsonCodec{}
+	ProtobufCodec Codec = protobufCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// protobufCodec only accepts proto.Message values
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string {
+	return "protobuf"
+}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	if m, isProto := v.(proto.Message); isProto {
+		return proto.Marshal(m)
+	}
+
+	return nil, fmt.Errorf("protobuf codec cannot encode %T", v)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	if m, isProto := v.(proto.Message); isProto {
+		return proto.Unmarshal(data, m)
+	}
+
+	return fmt.Errorf("protobuf codec cannot decode into %T", v)
+}
+
+// CodecRegistry picks the codec of a payload by node type, edge predicate, index type or meta key, falling
+// back to a default codec
+type CodecRegistry struct {
+	fallback Codec
+	nodes    map[uint32]Codec
+	edges    map[uint32]Codec
+	indexes  map[uint32]Codec
+	metas    map[uint32]Codec
+	mux      sync.RWMutex
+}
+
+func NewCodecRegistry(fallback Codec) *CodecRegistry {
+	return &CodecRegistry{
+		fallback: fallback,
+		nodes:    make(map[uint32]Codec),
+		edges:    make(map[uint32]Codec),
+		indexes:  make(map[uint32]Codec),
+		metas:    make(map[uint32]Codec),
+	}
+}
+
+func (r *CodecRegistry) set(codecs map[uint32]Codec, id uint32, c Codec) {
+	r.mux.Lock()
+	codecs[id] = c
+	r.mux.Unlock()
+}
+
+func (r *CodecRegistry) get(codecs map[uint32]Codec, id uint32) Codec {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	if c, found := codecs[id]; found {
+		return c
+	}
+
+	return r.fallback
+}
+
+func (r *CodecRegistry) SetNodeCodec(nodeType uint32, c Codec) {
+	r.set(r.nodes, nodeType, c)
+}
+
+func (r *CodecRegistry) SetEdgeCodec(predicate uint32, c Codec) {
+	r.set(r.edges, predicate, c)
+}
+
+func (r *CodecRegistry) SetIndexCodec(indexType uint32, c Codec) {
+	r.set(r.indexes, indexType, c)
+}
+
+func (r *CodecRegistry) SetMetaCodec(key uint32, c Codec) {
+	r.set(r.metas, key, c)
+}
+
+// CodecOf is the codec of the payload of a *pb.Node, *pb.Edge, *pb.Index or *pb.Meta, nil for other messages
+func (r *CodecRegistry) CodecOf(object proto.Message) Codec {
+	switch o := object.(type) {
+	case *pb.Node:
+		return r.get(r.nodes, o.Type)
+	case *pb.Edge:
+		return r.get(r.edges, o.Predicate)
+	case *pb.Index:
+		return r.get(r.indexes, o.Type)
+	case *pb.Meta:
+		return r.get(r.metas, o.Key)
+	default:
+		return nil
+	}
+}
+
+// Encode stores v as the payload of object: the properties, or the value of a meta
+func (r *CodecRegistry) Encode(object proto.Message, v interface{}) error {
+	c := r.CodecOf(object)
+
+	if c == nil {
+		return fmt.Errorf("%T has no payload", object)
+	}
+
+	data, err := c.Marshal(v)
+
+	if err != nil {
+		return fmt.Errorf("%s encode: %w", c.Name(), err)
+	}
+
+	switch o := object.(type) {
+	case *pb.Node:
+		o.Properties = data
+	case *pb.Edge:
+		o.Properties = data
+	case *pb.Index:
+		o.Properties = data
+	case *pb.Meta:
+		o.Val = data
+	}
+
+	return nil
+}
+
+// Decode reads the payload of object into v; an empty payload leaves v untouched
+func (r *CodecRegistry) Decode(object proto.Message, v interface{}) error {
+	c := r.CodecOf(object)
+
+	if c == nil {
+		return fmt.Errorf("%T has no payload", object)
+	}
+
+	data := payload(object)
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := c.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s decode: %w", c.Name(), err)
+	}
+
+	return nil
+}
+
+// NodeCreate encodes v into the properties of n, then queues it with Transaction.NodeCreate
+func (r *CodecRegistry) NodeCreate(c *Transaction, n *pb.Node, v interface{}) (*ActionHandle, error) {
+	if err := r.Encode(n, v); err != nil {
+		return nil, err
+	}
+
+	return c.NodeCreate(n), nil
+}
+
+func (r *CodecRegistry) NodeUpdate(c *Transaction, n *pb.Node, v interface{}) (*ActionHandle, error) {
+	if err := r.Encode(n, v); err != nil {
+		return nil, err
+	}
+
+	return c.NodeUpdate(n), nil
+}
+
+func (r *CodecRegistry) EdgeUpdate(c *Transaction, e *pb.Edge, v interface{}) (*ActionHandle, error) {
+	if err := r.Encode(e, v); err != nil {
+		return nil, err
+	}
+
+	return c.EdgeUpdate(e), nil
+}
+
+func (r *CodecRegistry) IndexCreate(c *Transaction, i *pb.Index, v interface{}) (*ActionHandle, error) {
+	if err := r.Encode(i, v); err != nil {
+		return nil, err
+	}
+
+	return c.IndexCreate(i), nil
+}
+
+func (r *CodecRegistry) MetaUpdate(c *Transaction, m *pb.Meta, v interface{}) (*ActionHandle, error) {
+	if err := r.Encode(m, v); err != nil {
+		return nil, err
+	}
+
+	return c.MetaUpdate(m), nil
+}
+
+// NodeGet reads a node and decodes its properties into v
+func (r *CodecRegistry) NodeGet(ctx context.Context, cli pb.CDSCabinetClient, in *pb.NodeGetRequest, v interface{}) (*pb.Node, error) {
+	n, err := cli.NodeGet(ctx, in)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return n, r.Decode(n, v)
+}
+
+func (r *CodecRegistry) EdgeGet(ctx context.Context, cli pb.CDSCabinetClient, in *pb.EdgeGetRequest, v interface{}) (*pb.Edge, error) {
+	e, err := cli.EdgeGet(ctx, in)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return e, r.Decode(e, v)
+}
+
+func (r *CodecRegistry) IndexGet(ctx context.Context, cli pb.CDSCabinetClient, in *pb.IndexGetRequest, v interface{}) (*pb.Index, error) {
+	i, err := cli.IndexGet(ctx, in)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i, r.Decode(i, v)
+}
+
+func (r *CodecRegistry) MetaGet(ctx context.Context, cli pb.CDSCabinetClient, in *pb.Meta, v interface{}) (*pb.Meta, error) {
+	m, err := cli.MetaGet(ctx, in)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m, r.Decode(m, v)
+}
+
+// Payload decodes the payload of a listed object with the codec chosen for it
+type Payload struct {
+	registry *CodecRegistry
+	object   proto.Message
+}
+
+func (p Payload) Decode(v interface{}) error {
+	return p.registry.Decode(p.object, v)
+}
+
+// each drains a list stream, handing every object to fn until fn fails
+func (r *CodecRegistry) each(recv func() (proto.Message, error), fn func(object proto.Message, p Payload) error) error {
+	for {
+		object, err := recv()
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := fn(object, Payload{registry: r, object: object}); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *CodecRegistry) NodeList(ctx context.Context, cli pb.CDSCabinetClient, in *pb.NodeListRequest, fn func(n *pb.Node, p Payload) error) error {
+	stream, err := cli.NodeList(ctx, in)
+
+	if err != nil {
+		return err
+	}
+
+	return r.each(func() (proto.Message, error) { return stream.Recv() }, func(object proto.Message, p Payload) error {
+		return fn(object.(*pb.Node), p)
+	})
+}
+
+func (r *CodecRegistry) EdgeList(ctx context.Context, cli pb.CDSCabinetClient, in *pb.EdgeListRequest, fn func(e *pb.Edge, p Payload) error) error {
+	stream, err := cli.EdgeList(ctx, in)
+
+	if err != nil {
+		return err
+	}
+
+	return r.each(func() (proto.Message, error) { return stream.Recv() }, func(object proto.Message, p Payload) error {
+		return fn(object.(*pb.Edge), p)
+	})
+}
+
+func (r *CodecRegistry) IndexList(ctx context.Context, cli pb.CDSCabinetClient, in *pb.IndexListRequest, fn func(i *pb.Index, p Payload) error) error {
+	stream, err := cli.IndexList(ctx, in)
+
+	if err != nil {
+		return err
+	}
+
+	return r.each(func() (proto.Message, error) { return stream.Recv() }, func(object proto.Message, p Payload) error {
+		return fn(object.(*pb.Index), p)
+	})
+}
+
+func (r *CodecRegistry) MetaList(ctx context.Context, cli pb.CDSCabinetClient, in *pb.MetaListRequest, fn func(m *pb.Meta, p Payload) error) error {
+	stream, err := cli.MetaList(ctx, in)
+
+	if err != nil {
+		return err
+	}
+
+	return r.each(func() (proto.Message, error) { return stream.Recv() }, func(object proto.Message, p Payload) error {
+		return fn(object.(*pb.Meta), p)
+	})
+}
@@ -0,0 +1,53 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+// Package codecs adds the msgpack and CBOR payload codecs. It is kept apart from cabinet so that only the
+// programs importing it depend on github.com/ugorji/go/codec.
+package codecs
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	"github.com/ugorji/go/codec"
+)
+
+var (
+	Msgpack cabinet.Codec = newHandleCodec("msgpack", msgpackHandle())
+	CBOR    cabinet.Codec = newHandleCodec("cbor", &codec.CborHandle{})
+)
+
+// msgpackHandle writes the current msgpack spec, where WriteExt enables the str8 and bin types, and decodes
+// the raw type of the old spec as strings
+func msgpackHandle() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	h.RawToString = true
+
+	return h
+}
+
+// handleCodec encodes with one of the ugorji formats
+type handleCodec struct {
+	name   string
+	handle codec.Handle
+}
+
+func newHandleCodec(name string, h codec.Handle) *handleCodec {
+	return &handleCodec{name: name, handle: h}
+}
+
+func (c *handleCodec) Name() string {
+	return c.name
+}
+
+func (c *handleCodec) Marshal(v interface{}) ([]byte, error) {
+	var data []byte
+	err := codec.NewEncoderBytes(&data, c.handle).Encode(v)
+
+	return data, err
+}
+
+func (c *handleCodec) Unmarshal(data []byte, v interface{}) error {
+	return codec.NewDecoderBytes(data, c.handle).Decode(v)
+}
@@ -0,0 +1,225 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"regexp"
+	"strconv"
+)
+
+// CabinetError is an entry in the error catalog; compare against it with errors.Is
+type CabinetError struct {
+	Name   string
+	Code   int        // server E(0x...) code, 0 when matched on the gRPC status
+	Status codes.Code // gRPC status, codes.OK when matched on the server code
+}
+
+func (e *CabinetError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("E(0x%03X) %s", e.Code, e.Name)
+	}
+
+	return e.Name
+}
+
+var (
+	// server codes, reported as E(0x...) in the status message
+	ErrReadCheckFailed = &CabinetError{Name: "read check failed", Code: 0x013}
+
+	// gRPC status codes
+	ErrCanceled           = &CabinetError{Name: "canceled", Status: codes.Canceled}
+	ErrUnknown            = &CabinetError{Name: "unknown", Status: codes.Unknown}
+	ErrInvalidArgument    = &CabinetError{Name: "invalid argument", Status: codes.InvalidArgument}
+	ErrDeadlineExceeded   = &CabinetError{Name: "deadline exceeded", Status: codes.DeadlineExceeded}
+	ErrNotFound           = &CabinetError{Name: "not found", Status: codes.NotFound}
+	ErrAlreadyExists      = &CabinetError{Name: "already exists", Status: codes.AlreadyExists}
+	ErrPermissionDenied   = &CabinetError{Name: "permission denied", Status: codes.PermissionDenied}
+	ErrResourceExhausted  = &CabinetError{Name: "resource exhausted", Status: codes.ResourceExhausted}
+	ErrFailedPrecondition = &CabinetError{Name: "failed precondition", Status: codes.FailedPrecondition}
+	ErrAborted            = &CabinetError{Name: "aborted", Status: codes.Aborted}
+	ErrOutOfRange         = &CabinetError{Name: "out of range", Status: codes.OutOfRange}
+	ErrUnimplemented      = &CabinetError{Name: "unimplemented", Status: codes.Unimplemented}
+	ErrInternal           = &CabinetError{Name: "internal", Status: codes.Internal}
+	ErrUnavailable        = &CabinetError{Name: "unavailable", Status: codes.Unavailable}
+	ErrDataLoss           = &CabinetError{Name: "data loss", Status: codes.DataLoss}
+	ErrUnauthenticated    = &CabinetError{Name: "unauthenticated", Status: codes.Unauthenticated}
+
+	// groups
+	ErrServer    = &CabinetError{Name: "server rejected the request"} // any E(0x...) code
+	ErrTransport = &CabinetError{Name: "transport failure"}           // connection, stream or network level failure
+)
+
+var serverCodes = map[int]*CabinetError{
+	ErrReadCheckFailed.Code: ErrReadCheckFailed,
+}
+
+var serverCodePattern = regexp.MustCompile(`E\(0x([0-9A-Fa-f]+)\)`)
+
+// ServerCode extracts the E(0x...) code from err, 0 when there is none
+func ServerCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	msg := err.Error()
+
+	if st, isStatus := status.FromError(err); isStatus {
+		msg = st.Message()
+	}
+
+	m := serverCodePattern.FindStringSubmatch(msg)
+
+	if m == nil {
+		return 0
+	}
+
+	code, pErr := strconv.ParseInt(m[1], 16, 32)
+
+	if pErr != nil {
+		return 0
+	}
+
+	return int(code)
+}
+
+// LookupServerCode returns the catalog entry for a server code, nil when unknown
+func LookupServerCode(code int) *CabinetError {
+	return serverCodes[code]
+}
+
+func isTransportStatus(st codes.Code) bool {
+	return st == codes.Unavailable
+}
+
+func isTransportClass(class int) bool {
+	switch class {
+	case TRANSACTION_ERROR_CONN, TRANSACTION_ERROR_CLOSING:
+		return true
+	default:
+		return false
+	}
+}
+
+func catalogMatch(target error, code int, st codes.Code, transport bool) bool {
+	t, isCatalog := target.(*CabinetError)
+
+	if !isCatalog {
+		return false
+	}
+
+	switch {
+	case t == ErrServer:
+		return code != 0
+	case t == ErrTransport:
+		return transport || isTransportStatus(st)
+	case t.Code != 0:
+		return t.Code == code
+	case t.Status != codes.OK:
+		return t.Status == st
+	default:
+		return false
+	}
+}
+
+type TransactionError struct {
+	msg      string
+	class    int
+	code     int
+	status   codes.Code
+	actionId uint32
+	err      error
+}
+
+// transactionFailure wraps an RPC error, decoding its status and server code
+func transactionFailure(class int, prefix string, err error) *TransactionError {
+	return &TransactionError{
+		msg:    fmt.Sprintf("%s%s", prefix, err),
+		class:  class,
+		code:   ServerCode(err),
+		status: status.Code(err),
+		err:    err,
+	}
+}
+
+func (e *TransactionError) Error() string {
+	return fmt.Sprintf("ERR(%d): %s", e.class, e.msg)
+}
+
+func (e *TransactionError) Message() string {
+	return e.msg
+}
+
+// Class is one of the TRANSACTION_ERROR_* constants
+func (e *TransactionError) Class() int {
+	return e.class
+}
+
+// Code is the server E(0x...) code, 0 when the server did not send one
+func (e *TransactionError) Code() int {
+	return e.code
+}
+
+// Status is the gRPC status code, codes.OK for errors raised locally
+func (e *TransactionError) Status() codes.Code {
+	return e.status
+}
+
+// ActionID is the failing action. Server errors carry no ActionId, so for those it is the first sent
+// action left without a response; 0 when unknown.
+func (e *TransactionError) ActionID() uint32 {
+	return e.actionId
+}
+
+func (e *TransactionError) Unwrap() error {
+	return e.err
+}
+
+func (e *TransactionError) Is(target error) bool {
+	return catalogMatch(target, e.code, e.status, isTransportClass(e.class))
+}
+
+// RPCError is a decoded error of a plain (non transaction) cabinet RPC
+type RPCError struct {
+	code   int
+	status codes.Code
+	err    error
+}
+
+// Decode makes errors returned by CDSCabinetClient calls comparable with the catalog through errors.Is
+func Decode(err error) error {
+	var trxErr *TransactionError
+
+	if err == nil || errors.As(err, &trxErr) {
+		return err
+	}
+
+	return &RPCError{code: ServerCode(err), status: status.Code(err), err: err}
+}
+
+func (e *RPCError) Error() string {
+	return e.err.Error()
+}
+
+func (e *RPCError) Code() int {
+	return e.code
+}
+
+func (e *RPCError) Status() codes.Code {
+	return e.status
+}
+
+func (e *RPCError) Unwrap() error {
+	return e.err
+}
+
+func (e *RPCError) Is(target error) bool {
+	return catalogMatch(target, e.code, e.status, false)
+}
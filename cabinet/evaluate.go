@@ -0,0 +1,146 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	"bytes"
+	"cds.ikigai.net/cabinet.v1.test/cabinet/iri"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"strings"
+)
+
+// ObjectSet holds nodes, edges, index entries and metas by IRI, as the server would see them
+type ObjectSet map[string]proto.Message
+
+func NewObjectSet(objects ...proto.Message) ObjectSet {
+	s := make(ObjectSet)
+	s.Add(objects...)
+
+	return s
+}
+
+// Add stores objects under their IRIs; messages other than *pb.Node, *pb.Edge, *pb.Index and *pb.Meta are
+// ignored
+func (s ObjectSet) Add(objects ...proto.Message) {
+	for _, object := range objects {
+		switch o := object.(type) {
+		case *pb.Node:
+			s[iri.NodeOf(o).String()] = o
+		case *pb.Edge:
+			s[iri.EdgeOf(o).String()] = o
+		case *pb.Index:
+			s[iri.IndexOf(o).String()] = o
+		case *pb.Meta:
+			if address := iri.MetaOf(o); address != nil {
+				s[address.String()] = o
+			}
+		}
+	}
+}
+
+// payload is what EQUAL and NOT_EQUAL compare: the properties, or the value of a meta
+func payload(object proto.Message) []byte {
+	switch o := object.(type) {
+	case *pb.Node:
+		return o.Properties
+	case *pb.Edge:
+		return o.Properties
+	case *pb.Index:
+		return o.Properties
+	case *pb.Meta:
+		return o.Val
+	default:
+		return nil
+	}
+}
+
+// lookup finds the object at address; a wildcard address matches any object under it
+func (s ObjectSet) lookup(address iri.IRI) (proto.Message, bool) {
+	if !address.Wildcard() {
+		object, found := s[address.String()]
+		return object, found
+	}
+
+	prefix := strings.TrimSuffix(address.String(), WILDCARD)
+
+	for key, object := range s {
+		if strings.HasPrefix(key, prefix) {
+			return object, true
+		}
+	}
+
+	return nil, false
+}
+
+// EvaluateReadCheck predicts the server's answer to r over objects. EXISTS and TOUCH hold when the source
+// exists; EQUAL and NOT_EQUAL compare the payload of the source with the target value or the payload of the
+// target object, and fail when either object is missing.
+func EvaluateReadCheck(r *pb.ReadCheckRequest, objects ObjectSet) (bool, error) {
+	if r == nil || r.Target == nil || r.Target.Target == nil {
+		return false, fmt.Errorf("incomplete read check %v", r)
+	}
+
+	source, err := iri.Parse(r.Source)
+
+	if err != nil {
+		return false, err
+	}
+
+	object, found := objects.lookup(source)
+
+	switch r.Operator {
+	case pb.CheckOperators_EXISTS, pb.CheckOperators_TOUCH:
+		return found, nil
+	case pb.CheckOperators_EQUAL, pb.CheckOperators_NOT_EQUAL:
+		if source.Wildcard() {
+			return false, fmt.Errorf("%w %q: %s needs a single object", ErrWildcard, r.Source, r.Operator)
+		}
+	default:
+		return false, fmt.Errorf("unknown read check operator %s", r.Operator)
+	}
+
+	var expected []byte
+
+	switch t := r.Target.Target.(type) {
+	case *pb.CheckTarget_Val:
+		expected = []byte(t.Val)
+	case *pb.CheckTarget_Iri:
+		target, err := iri.Parse(t.Iri)
+
+		if err != nil {
+			return false, err
+		} else if target.Wildcard() {
+			return false, fmt.Errorf("%w %q: %s needs a single object", ErrWildcard, t.Iri, r.Operator)
+		}
+
+		other, exists := objects.lookup(target)
+
+		if !exists {
+			return false, nil
+		}
+
+		expected = payload(other)
+	}
+
+	if !found {
+		return false, nil
+	}
+
+	equal := bytes.Equal(payload(object), expected)
+	return equal == (r.Operator == pb.CheckOperators_EQUAL), nil
+}
+
+// Evaluate predicts the outcome of the condition over objects
+func (cond *Condition) Evaluate(objects ObjectSet) (bool, error) {
+	if cond.err != nil {
+		return false, cond.err
+	}
+
+	return EvaluateReadCheck(cond.req, objects)
+}
@@ -0,0 +1,105 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+)
+
+// BeforeSendFunc sees a copy of each action right before it is sent and may modify it. An error vetoes the
+// action and fails the commit before any action of the current stream is sent; with chunking, earlier chunks
+// are already committed, and with undo enabled the pre-images have already been read.
+type BeforeSendFunc func(ctx context.Context, o *pb.TransactionAction) error
+
+// AfterResponseFunc sees each response as it arrives, with the queued action it answers
+type AfterResponseFunc func(ctx context.Context, o *pb.TransactionAction, r *pb.TransactionActionResponse)
+
+type CommitFunc func(ctx context.Context) error
+
+// AroundCommitFunc wraps Commit(); it runs while the transaction is still building, so it may queue more
+// actions before calling next
+type AroundCommitFunc func(ctx context.Context, trx *Transaction, next CommitFunc) error
+
+// Hooks groups the callbacks of one middleware; nil callbacks are skipped
+type Hooks struct {
+	BeforeSend    BeforeSendFunc
+	AfterResponse AfterResponseFunc
+	AroundCommit  AroundCommitFunc
+}
+
+// Use registers hooks. They run in registration order; the first AroundCommit registered is the outermost.
+func (c *Transaction) Use(hooks ...*Hooks) {
+	c.hooks = append(c.hooks, hooks...)
+}
+
+// aroundCommit builds the AroundCommit chain ending in commit
+func (c *Transaction) aroundCommit(commit CommitFunc) CommitFunc {
+	next := commit
+
+	for h := len(c.hooks) - 1; h >= 0; h-- {
+		if around := c.hooks[h].AroundCommit; around != nil {
+			inner := next
+			next = func(ctx context.Context) error {
+				return around(ctx, c, inner)
+			}
+		}
+	}
+
+	return next
+}
+
+// prepare runs the BeforeSend hooks over the actions of one attempt, returning what should be sent. The
+// queued actions are left untouched, so a retry starts again from them.
+func (c *Transaction) prepare(ctx context.Context, ids []uint32) ([]*pb.TransactionAction, error) {
+	batch := make([]*pb.TransactionAction, len(ids))
+	hooked := false
+
+	for _, h := range c.hooks {
+		hooked = hooked || h.BeforeSend != nil
+	}
+
+	for i, aID := range ids {
+		batch[i] = c.actions[aID]
+
+		if !hooked {
+			continue
+		}
+
+		o := proto.Clone(c.actions[aID]).(*pb.TransactionAction)
+
+		for _, h := range c.hooks {
+			if h.BeforeSend == nil {
+				continue
+			}
+
+			if err := h.BeforeSend(ctx, o); err != nil {
+				return nil, &TransactionError{
+					msg:      fmt.Sprintf("action %d: vetoed: %v", aID, err),
+					class:    TRANSACTION_ERROR_VETO,
+					actionId: aID,
+					err:      err,
+				}
+			}
+		}
+
+		o.ActionId = aID
+		batch[i] = o
+	}
+
+	return batch, nil
+}
+
+func (c *Transaction) afterResponse(ctx context.Context, r *pb.TransactionActionResponse) {
+	for _, h := range c.hooks {
+		if h.AfterResponse != nil {
+			h.AfterResponse(ctx, c.actions[r.ActionId], r)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+// Package iri builds, parses and validates the IRIs naming cabinet objects in read checks:
+//
+//	n/<type>/<id>                          node
+//	e/<subject>/<predicate>/<target>       edge, target * for all targets
+//	i/<type>/<value>/<node>                index, / in the value escaped as %2F; values holding %2F are ambiguous
+//	m/n/<id>/<key>                         node meta, key * for all keys
+//	m/e/<subject>/<predicate>/<target>/<key>
+//	c/n/<id>/<counter>                     node counter
+//	c/e/<subject>/<predicate>/<target>/<counter>
+package iri
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"errors"
+	"fmt"
+	"github.com/segmentio/ksuid"
+	"strconv"
+	"strings"
+)
+
+const WILDCARD = "*"
+
+var ErrMalformed = errors.New("malformed IRI")
+
+type IRI interface {
+	String() string
+	Wildcard() bool // true when the IRI names a set of objects
+}
+
+type Node struct {
+	Type uint32
+	Id   string
+}
+
+type Edge struct {
+	Subject   string
+	Predicate uint32
+	Target    string // WILDCARD for every target
+}
+
+type Index struct {
+	Type  uint32
+	Value string // unescaped
+	Node  string
+}
+
+type NodeMeta struct {
+	Node string
+	Key  uint32 // 0 for every key
+}
+
+type EdgeMeta struct {
+	Edge Edge
+	Key  uint32 // 0 for every key
+}
+
+type NodeCounter struct {
+	Node    string
+	Counter uint32
+}
+
+type EdgeCounter struct {
+	Edge    Edge
+	Counter uint32
+}
+
+var (
+	valueEscaper   = strings.NewReplacer("/", "%2F")
+	valueUnescaper = strings.NewReplacer("%2F", "/", "%2f", "/")
+)
+
+// EscapeValue only escapes /, so index IRIs of values without one read as they always did; any other % is
+// kept as is
+func EscapeValue(value string) string {
+	return valueEscaper.Replace(value)
+}
+
+func UnescapeValue(value string) string {
+	return valueUnescaper.Replace(value)
+}
+
+// AmbiguousValue is true for index values holding %2F: it reads back as an escaped /, so their IRI names
+// another index
+func AmbiguousValue(value string) bool {
+	return strings.Contains(strings.ToUpper(value), "%2F")
+}
+
+func key(k uint32) string {
+	if k == 0 {
+		return WILDCARD
+	}
+
+	return strconv.FormatUint(uint64(k), 10)
+}
+
+func (n Node) String() string {
+	return fmt.Sprintf("n/%d/%s", n.Type, n.Id)
+}
+
+func (n Node) Wildcard() bool {
+	return false
+}
+
+func (e Edge) String() string {
+	return fmt.Sprintf("e/%s/%d/%s", e.Subject, e.Predicate, e.Target)
+}
+
+func (e Edge) Wildcard() bool {
+	return e.Target == WILDCARD
+}
+
+func (i Index) String() string {
+	return fmt.Sprintf("i/%d/%s/%s", i.Type, EscapeValue(i.Value), i.Node)
+}
+
+func (i Index) Wildcard() bool {
+	return false
+}
+
+func (m NodeMeta) String() string {
+	return fmt.Sprintf("m/n/%s/%s", m.Node, key(m.Key))
+}
+
+func (m NodeMeta) Wildcard() bool {
+	return m.Key == 0
+}
+
+func (m EdgeMeta) String() string {
+	return fmt.Sprintf("m/%s/%s", m.Edge, key(m.Key))
+}
+
+func (m EdgeMeta) Wildcard() bool {
+	return m.Key == 0
+}
+
+func (s NodeCounter) String() string {
+	return fmt.Sprintf("c/n/%s/%d", s.Node, s.Counter)
+}
+
+func (s NodeCounter) Wildcard() bool {
+	return false
+}
+
+func (s EdgeCounter) String() string {
+	return fmt.Sprintf("c/%s/%d", s.Edge, s.Counter)
+}
+
+func (s EdgeCounter) Wildcard() bool {
+	return false
+}
+
+func NodeOf(n *pb.Node) Node {
+	return Node{Type: n.Type, Id: n.Id}
+}
+
+func EdgeOf(e *pb.Edge) Edge {
+	return Edge{Subject: e.Subject, Predicate: e.Predicate, Target: e.Target}
+}
+
+func IndexOf(i *pb.Index) Index {
+	return Index{Type: i.Type, Value: i.Value, Node: i.Node}
+}
+
+// MetaOf is a NodeMeta or an EdgeMeta, nil when m has no object
+func MetaOf(m *pb.Meta) IRI {
+	switch mo := m.Object.(type) {
+	case *pb.Meta_Node:
+		return NodeMeta{Node: mo.Node, Key: m.Key}
+	case *pb.Meta_Edge:
+		return EdgeMeta{Edge: EdgeOf(mo.Edge), Key: m.Key}
+	default:
+		return nil
+	}
+}
+
+// CounterOf is a NodeCounter or an EdgeCounter, nil when s has no object
+func CounterOf(s *pb.Counter) IRI {
+	switch so := s.Object.(type) {
+	case *pb.Counter_Node:
+		return NodeCounter{Node: so.Node, Counter: s.Counter}
+	case *pb.Counter_Edge:
+		return EdgeCounter{Edge: EdgeOf(so.Edge), Counter: s.Counter}
+	default:
+		return nil
+	}
+}
+
+// Proto returns the object named by the IRI as a request message, without properties or value
+func (n Node) Proto() *pb.Node {
+	return &pb.Node{Type: n.Type, Id: n.Id}
+}
+
+func (e Edge) Proto() *pb.Edge {
+	return &pb.Edge{Subject: e.Subject, Predicate: e.Predicate, Target: e.Target}
+}
+
+func (i Index) Proto() *pb.Index {
+	return &pb.Index{Type: i.Type, Value: i.Value, Node: i.Node}
+}
+
+func (m NodeMeta) Proto() *pb.Meta {
+	return &pb.Meta{Object: &pb.Meta_Node{Node: m.Node}, Key: m.Key}
+}
+
+func (m EdgeMeta) Proto() *pb.Meta {
+	return &pb.Meta{Object: &pb.Meta_Edge{Edge: m.Edge.Proto()}, Key: m.Key}
+}
+
+func (s NodeCounter) Proto() *pb.Counter {
+	return &pb.Counter{Object: &pb.Counter_Node{Node: s.Node}, Counter: s.Counter}
+}
+
+func (s EdgeCounter) Proto() *pb.Counter {
+	return &pb.Counter{Object: &pb.Counter_Edge{Edge: s.Edge.Proto()}, Counter: s.Counter}
+}
+
+// parser consumes the segments of one IRI, keeping the first problem found
+type parser struct {
+	iri      string
+	segments []string
+	err      error
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf("%w %q: %s", ErrMalformed, p.iri, fmt.Sprintf(format, args...))
+	}
+}
+
+func (p *parser) next(field string) string {
+	if len(p.segments) == 0 {
+		p.fail("missing %s", field)
+		return ""
+	}
+
+	s := p.segments[0]
+	p.segments = p.segments[1:]
+
+	return s
+}
+
+func (p *parser) number(field string, wildcard bool) uint32 {
+	s := p.next(field)
+
+	if p.err != nil {
+		return 0
+	} else if s == WILDCARD {
+		if !wildcard {
+			p.fail("%s cannot be a wildcard", field)
+		}
+
+		return 0
+	}
+
+	n, err := strconv.ParseUint(s, 10, 32)
+
+	if err != nil || n == 0 {
+		p.fail("%s %q is not a positive 32 bit number", field, s)
+	}
+
+	return uint32(n)
+}
+
+func (p *parser) id(field string, wildcard bool) string {
+	s := p.next(field)
+
+	if p.err != nil {
+		return ""
+	} else if s == WILDCARD {
+		if !wildcard {
+			p.fail("%s cannot be a wildcard", field)
+		}
+	} else if _, err := ksuid.Parse(s); err != nil {
+		p.fail("%s %q is not a KSUID", field, s)
+	}
+
+	return s
+}
+
+func (p *parser) edge(wildcard bool) Edge {
+	return Edge{Subject: p.id("edge subject", false), Predicate: p.number("edge predicate", false), Target: p.id("edge target", wildcard)}
+}
+
+func (p *parser) done() {
+	if p.err == nil && len(p.segments) > 0 {
+		p.fail("unexpected %q", strings.Join(p.segments, "/"))
+	}
+}
+
+// Parse validates s and returns its typed IRI. IDs must be KSUIDs, types, keys and counters positive
+// numbers; wildcards are only accepted as edge targets and meta keys.
+func Parse(s string) (IRI, error) {
+	p := &parser{iri: s, segments: strings.Split(s, "/")}
+	var parsed IRI
+
+	switch p.next("kind") {
+	case "n":
+		parsed = Node{Type: p.number("node type", false), Id: p.id("node id", false)}
+	case "e":
+		parsed = p.edge(true)
+	case "i":
+		index := Index{Type: p.number("index type", false)}
+		index.Value = UnescapeValue(p.next("index value"))
+		index.Node = p.id("index node", false)
+
+		if p.err == nil && index.Value == "" {
+			p.fail("empty index value")
+		}
+
+		parsed = index
+	case "m":
+		switch p.next("meta object") {
+		case "n":
+			parsed = NodeMeta{Node: p.id("meta node", false), Key: p.number("meta key", true)}
+		case "e":
+			parsed = EdgeMeta{Edge: p.edge(false), Key: p.number("meta key", true)}
+		default:
+			p.fail("meta object must be n or e")
+		}
+	case "c":
+		switch p.next("counter object") {
+		case "n":
+			parsed = NodeCounter{Node: p.id("counter node", false), Counter: p.number("counter", false)}
+		case "e":
+			parsed = EdgeCounter{Edge: p.edge(false), Counter: p.number("counter", false)}
+		default:
+			p.fail("counter object must be n or e")
+		}
+	default:
+		p.fail("unknown kind")
+	}
+
+	p.done()
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return parsed, nil
+}
+
+func MustParse(s string) IRI {
+	parsed, err := Parse(s)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return parsed
+}
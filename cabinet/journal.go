@@ -0,0 +1,246 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	"bufio"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"strings"
+	"time"
+)
+
+type JournalFormat uint8
+
+const (
+	JOURNAL_PROTO JournalFormat = iota // length-delimited: a JSON header record, then one pb.TransactionAction per record
+	JOURNAL_JSONL                      // a JSON header line, then one action per line in protobuf JSON
+)
+
+const JOURNAL_VERSION = 1
+
+// journalMaxRecord guards against reading a corrupt length prefix as a huge allocation
+const journalMaxRecord = 64 << 20
+
+type JournalHeader struct {
+	Version      int               `json:"version"`
+	Created      time.Time         `json:"created"`
+	State        string            `json:"state"`
+	Actions      int               `json:"actions"`
+	NextActionId uint32            `json:"next_action_id"`
+	TmpIDs       map[uint32]string `json:"tmp_ids,omitempty"` // ActionId of a NodeCreate -> temporary ID it introduces
+	IdMap        map[string]string `json:"id_map,omitempty"`  // temporary ID -> real ID, once committed
+}
+
+// Journal is a serialized transaction: actions are stored in queue order with their original temporary IDs
+type Journal struct {
+	Header  JournalHeader
+	Actions []*pb.TransactionAction
+}
+
+// Journal snapshots the queued actions and temporary ID metadata
+func (c *Transaction) Journal() *Journal {
+	j := &Journal{
+		Header: JournalHeader{
+			Version:      JOURNAL_VERSION,
+			Created:      time.Now().UTC(),
+			State:        c.State().String(),
+			Actions:      len(c.actionIDs),
+			NextActionId: c.actPos,
+			TmpIDs:       make(map[uint32]string),
+			IdMap:        make(map[string]string),
+		},
+		Actions: c.pristineActions(),
+	}
+
+	c.mapMux.Lock()
+	for aID, tmpID := range c.tmpMap {
+		j.Header.TmpIDs[aID] = tmpID
+	}
+
+	for tmpID, realID := range c.idMap {
+		j.Header.IdMap[tmpID] = realID
+	}
+	c.mapMux.Unlock()
+
+	return j
+}
+
+func (c *Transaction) WriteJournal(w io.Writer, format JournalFormat) error {
+	return c.Journal().Write(w, format)
+}
+
+func (j *Journal) Write(w io.Writer, format JournalFormat) error {
+	header, err := json.Marshal(j.Header)
+
+	if err != nil {
+		return fmt.Errorf("journal header: %w", err)
+	}
+
+	bw := bufio.NewWriter(w)
+
+	switch format {
+	case JOURNAL_PROTO:
+		if err := writeRecord(bw, header); err != nil {
+			return err
+		}
+
+		for _, o := range j.Actions {
+			data, err := proto.Marshal(o)
+
+			if err != nil {
+				return fmt.Errorf("journal action %d: %w", o.ActionId, err)
+			} else if err := writeRecord(bw, data); err != nil {
+				return err
+			}
+		}
+	case JOURNAL_JSONL:
+		bw.Write(header)
+		bw.WriteByte('\n')
+
+		m := jsonpb.Marshaler{}
+
+		for _, o := range j.Actions {
+			line, err := m.MarshalToString(o)
+
+			if err != nil {
+				return fmt.Errorf("journal action %d: %w", o.ActionId, err)
+			}
+
+			bw.WriteString(line)
+			bw.WriteByte('\n')
+		}
+	default:
+		return fmt.Errorf("unknown journal format %d", format)
+	}
+
+	return bw.Flush()
+}
+
+func writeRecord(w *bufio.Writer, data []byte) error {
+	var prefix [binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(prefix[:], uint64(len(data)))
+
+	if _, err := w.Write(prefix[:n]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(data)
+	return err
+}
+
+func readRecord(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+
+	if err != nil {
+		return nil, err
+	} else if size > journalMaxRecord {
+		return nil, fmt.Errorf("journal record of %d bytes is too large", size)
+	}
+
+	data := make([]byte, size)
+
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return data, nil
+}
+
+func ReadJournal(r io.Reader, format JournalFormat) (*Journal, error) {
+	br := bufio.NewReader(r)
+	j := &Journal{Actions: make([]*pb.TransactionAction, 0)}
+
+	var header []byte
+	var err error
+
+	switch format {
+	case JOURNAL_PROTO:
+		header, err = readRecord(br)
+	case JOURNAL_JSONL:
+		header, err = br.ReadBytes('\n')
+
+		if err == io.EOF && len(header) > 0 {
+			err = nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown journal format %d", format)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("journal header: %w", err)
+	} else if err := json.Unmarshal(header, &j.Header); err != nil {
+		return nil, fmt.Errorf("journal header: %w", err)
+	} else if j.Header.Version != JOURNAL_VERSION {
+		return nil, fmt.Errorf("unsupported journal version %d", j.Header.Version)
+	}
+
+	for {
+		o := &pb.TransactionAction{}
+
+		if format == JOURNAL_PROTO {
+			data, err := readRecord(br)
+
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("journal record %d: %w", len(j.Actions)+1, err)
+			} else if err := proto.Unmarshal(data, o); err != nil {
+				return nil, fmt.Errorf("journal record %d: %w", len(j.Actions)+1, err)
+			}
+		} else {
+			line, err := br.ReadString('\n')
+
+			if err == io.EOF && line == "" {
+				break
+			} else if err != nil && err != io.EOF {
+				return nil, fmt.Errorf("journal line %d: %w", len(j.Actions)+2, err)
+			} else if strings.TrimSpace(line) == "" {
+				continue
+			} else if err := jsonpb.UnmarshalString(line, o); err != nil {
+				return nil, fmt.Errorf("journal line %d: %w", len(j.Actions)+2, err)
+			}
+		}
+
+		j.Actions = append(j.Actions, o)
+	}
+
+	if len(j.Actions) != j.Header.Actions {
+		return nil, fmt.Errorf("journal is truncated: %d of %d actions", len(j.Actions), j.Header.Actions)
+	}
+
+	return j, nil
+}
+
+// Transaction queues the journaled actions, with their original ActionIds, into a new building transaction
+func (j *Journal) Transaction(ctx context.Context, cli pb.CDSCabinetClient) *Transaction {
+	c := &Transaction{}
+	c.Setup(ctx, cli)
+
+	for _, o := range j.Actions {
+		c.Operation(*proto.Clone(o).(*pb.TransactionAction))
+	}
+
+	if j.Header.NextActionId > c.actPos {
+		c.actPos = j.Header.NextActionId
+	}
+
+	return c
+}
+
+// Replay commits the journaled actions against cli. Temporary IDs are created again, so they get new real IDs.
+func (j *Journal) Replay(ctx context.Context, cli pb.CDSCabinetClient) (*Transaction, error) {
+	c := j.Transaction(ctx, cli)
+	return c, c.Commit()
+}
@@ -0,0 +1,334 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	METRIC_RPC_CALLS       = "cabinet_rpc_calls_total"
+	METRIC_RPC_DURATION    = "cabinet_rpc_duration_seconds"
+	METRIC_COMMITS         = "cabinet_transaction_commits_total"
+	METRIC_COMMIT_DURATION = "cabinet_transaction_commit_duration_seconds"
+	METRIC_COMMIT_ACTIONS  = "cabinet_transaction_actions"
+	METRIC_SENT_ACTIONS    = "cabinet_transaction_sent_actions_total"
+	METRIC_SENT_BYTES      = "cabinet_transaction_sent_bytes_total"
+	METRIC_COMMIT_ERRORS   = "cabinet_transaction_errors_total"
+)
+
+var latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+var actionBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+var errorClassNames = map[int]string{
+	TRANSACTION_ERROR_CONN:       "conn",
+	TRANSACTION_ERROR_CLOSING:    "closing",
+	TRANSACTION_ERROR_SENDING:    "sending",
+	TRANSACTION_ERROR_RESPONSE:   "response",
+	TRANSACTION_ERROR_CANCELED:   "canceled",
+	TRANSACTION_ERROR_OPERATION:  "operation",
+	TRANSACTION_ERROR_EMPTY:      "empty",
+	TRANSACTION_ERROR_TMP_ID:     "tmp_id",
+	TRANSACTION_ERROR_VALIDATION: "validation",
+	TRANSACTION_ERROR_STATE:      "state",
+	TRANSACTION_ERROR_ORDER:      "order",
+	TRANSACTION_ERROR_UNDO:       "undo",
+	TRANSACTION_ERROR_VETO:       "veto",
+}
+
+func errorClassName(err error) string {
+	var trxErr *TransactionError
+
+	if !errors.As(err, &trxErr) {
+		return "other"
+	} else if name, known := errorClassNames[trxErr.Class()]; known {
+		return name
+	}
+
+	return strconv.Itoa(trxErr.Class())
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	buckets []float64 // nil for counters
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	value  float64  // counter value, or the sum of a histogram
+	counts []uint64 // observations per bucket, not cumulative
+	count  uint64
+}
+
+// Metrics collects client side counters and latency histograms. It serves them in the Prometheus text
+// format, so it can be mounted as a scrape endpoint.
+type Metrics struct {
+	mux      sync.Mutex
+	families []*metricFamily
+	byName   map[string]*metricFamily
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{byName: make(map[string]*metricFamily)}
+
+	m.register(METRIC_RPC_CALLS, "CDSCabinet calls by method and status code.", nil)
+	m.register(METRIC_RPC_DURATION, "CDSCabinet call latency in seconds; streams are timed until they end.", latencyBuckets)
+	m.register(METRIC_COMMITS, "Transaction commits by result.", nil)
+	m.register(METRIC_COMMIT_DURATION, "Transaction commit duration in seconds, retries included.", latencyBuckets)
+	m.register(METRIC_COMMIT_ACTIONS, "Actions per transaction commit.", actionBuckets)
+	m.register(METRIC_SENT_ACTIONS, "Transaction actions committed by kind, once however many attempts it took.", nil)
+	m.register(METRIC_SENT_BYTES, "Encoded transaction action bytes committed, once however many attempts it took.", nil)
+	m.register(METRIC_COMMIT_ERRORS, "Failed transaction commits by error class.", nil)
+
+	return m
+}
+
+func (m *Metrics) register(name string, help string, buckets []float64) {
+	f := &metricFamily{name: name, help: help, buckets: buckets, series: make(map[string]*metricSeries)}
+
+	m.families = append(m.families, f)
+	m.byName[name] = f
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders key, value pairs as a label set
+func formatLabels(pairs ...string) string {
+	labels := make([]string, 0, len(pairs)/2)
+
+	for l := 0; l+1 < len(pairs); l += 2 {
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, pairs[l], labelEscaper.Replace(pairs[l+1])))
+	}
+
+	return strings.Join(labels, ",")
+}
+
+func (m *Metrics) series(name string, labels string) *metricSeries {
+	f := m.byName[name]
+	s, exists := f.series[labels]
+
+	if !exists {
+		s = &metricSeries{counts: make([]uint64, len(f.buckets))}
+		f.series[labels] = s
+	}
+
+	return s
+}
+
+func (m *Metrics) add(name string, v float64, labels ...string) {
+	m.mux.Lock()
+	m.series(name, formatLabels(labels...)).value += v
+	m.mux.Unlock()
+}
+
+func (m *Metrics) observe(name string, v float64, labels ...string) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	s := m.series(name, formatLabels(labels...))
+	s.value += v
+	s.count += 1
+
+	for b, bound := range m.byName[name].buckets {
+		if v <= bound {
+			s.counts[b] += 1
+			break
+		}
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func withLabels(name string, labels ...string) string {
+	set := make([]string, 0, len(labels))
+
+	for _, l := range labels {
+		if l != "" {
+			set = append(set, l)
+		}
+	}
+
+	if len(set) == 0 {
+		return name
+	}
+
+	return fmt.Sprintf("%s{%s}", name, strings.Join(set, ","))
+}
+
+// Write renders every metric in the Prometheus text exposition format
+func (m *Metrics) Write(w io.Writer) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	bw := bufio.NewWriter(w)
+
+	for _, f := range m.families {
+		kind := "counter"
+
+		if f.buckets != nil {
+			kind = "histogram"
+		}
+
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, kind)
+
+		labelSets := make([]string, 0, len(f.series))
+
+		for labels := range f.series {
+			labelSets = append(labelSets, labels)
+		}
+
+		sort.Strings(labelSets)
+
+		for _, labels := range labelSets {
+			s := f.series[labels]
+
+			if f.buckets == nil {
+				fmt.Fprintf(bw, "%s %s\n", withLabels(f.name, labels), formatFloat(s.value))
+				continue
+			}
+
+			cumulative := uint64(0)
+
+			for b, bound := range f.buckets {
+				cumulative += s.counts[b]
+				fmt.Fprintf(bw, "%s %d\n", withLabels(f.name+"_bucket", labels, fmt.Sprintf(`le="%s"`, formatFloat(bound))), cumulative)
+			}
+
+			fmt.Fprintf(bw, "%s %d\n", withLabels(f.name+"_bucket", labels, `le="+Inf"`), s.count)
+			fmt.Fprintf(bw, "%s %s\n", withLabels(f.name+"_sum", labels), formatFloat(s.value))
+			fmt.Fprintf(bw, "%s %d\n", withLabels(f.name+"_count", labels), s.count)
+		}
+	}
+
+	return bw.Flush()
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if err := m.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Hooks counts commits, their duration, size and error classes, and the actions and bytes committed. Actions
+// are counted once their stream commits, so vetoed and retried sends are not counted; a failed chunked commit
+// counts the chunks it applied. Dry runs are not counted.
+func (m *Metrics) Hooks() *Hooks {
+	return &Hooks{
+		AroundCommit: func(ctx context.Context, trx *Transaction, next CommitFunc) error {
+			if trx.dryRun != nil {
+				return next(ctx)
+			}
+
+			// a resumed chunked commit already counted its first chunks
+			counted := make(map[uint32]bool, len(trx.committed))
+
+			for aID := range trx.committed {
+				counted[aID] = true
+			}
+
+			start := time.Now()
+			err := next(ctx)
+
+			for _, aID := range trx.actionIDs {
+				if o := trx.actions[aID]; trx.committed[aID] && !counted[aID] {
+					m.add(METRIC_SENT_ACTIONS, 1, "kind", KindOf(o).String())
+					m.add(METRIC_SENT_BYTES, float64(proto.Size(o)))
+				}
+			}
+
+			m.observe(METRIC_COMMIT_DURATION, time.Since(start).Seconds())
+			m.observe(METRIC_COMMIT_ACTIONS, float64(len(trx.actionIDs)))
+
+			if err != nil {
+				m.add(METRIC_COMMITS, 1, "result", "failed")
+				m.add(METRIC_COMMIT_ERRORS, 1, "class", errorClassName(err))
+			} else {
+				m.add(METRIC_COMMITS, 1, "result", "committed")
+			}
+
+			return err
+		},
+	}
+}
+
+// rpcDone records a finished call to method, named after its last path element
+func (m *Metrics) rpcDone(method string, start time.Time, err error) {
+	method = path.Base(method)
+
+	m.add(METRIC_RPC_CALLS, 1, "method", method, "code", status.Code(err).String())
+	m.observe(METRIC_RPC_DURATION, time.Since(start).Seconds(), "method", method)
+}
+
+// UnaryClientInterceptor counts and times every unary CDSCabinetClient call; install with grpc.WithUnaryInterceptor
+func (m *Metrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		m.rpcDone(method, start, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor counts and times streaming calls, such as the transaction stream
+func (m *Metrics) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+
+		if err != nil {
+			m.rpcDone(method, start, err)
+			return nil, err
+		}
+
+		return &meteredStream{ClientStream: stream, metrics: m, method: method, start: start}, nil
+	}
+}
+
+type meteredStream struct {
+	grpc.ClientStream
+
+	metrics *Metrics
+	method  string
+	start   time.Time
+	once    sync.Once
+}
+
+func (s *meteredStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+
+	if err != nil {
+		s.once.Do(func() {
+			if err == io.EOF {
+				s.metrics.rpcDone(s.method, s.start, nil)
+			} else {
+				s.metrics.rpcDone(s.method, s.start, err)
+			}
+		})
+	}
+
+	return err
+}
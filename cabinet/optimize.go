@@ -0,0 +1,224 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"sort"
+	"strings"
+)
+
+type RewriteOp uint8
+
+const (
+	REWRITE_MERGED  RewriteOp = iota // counter increment added to an earlier increment of the same counter
+	REWRITE_FOLDED                   // node update folded into the NodeCreate of the same node
+	REWRITE_DROPPED                  // write made pointless by a later delete or clear of the same object
+)
+
+var rewriteOpNames = map[RewriteOp]string{
+	REWRITE_MERGED:  "merged",
+	REWRITE_FOLDED:  "folded",
+	REWRITE_DROPPED: "dropped",
+}
+
+func (op RewriteOp) String() string {
+	if name, known := rewriteOpNames[op]; known {
+		return name
+	}
+
+	return fmt.Sprintf("RewriteOp(%d)", uint8(op))
+}
+
+// Rewrite is one action removed by the optimizer; Into is the action it was merged or folded into, or the
+// delete or clear that made it pointless
+type Rewrite struct {
+	Op       RewriteOp
+	ActionId uint32
+	Kind     ActionKind
+	IRI      string
+	Into     uint32
+}
+
+type OptimizeReport struct {
+	Before   int
+	After    int
+	Rewrites []Rewrite
+}
+
+func (r *OptimizeReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d action(s) -> %d", r.Before, r.After)
+
+	for _, rw := range r.Rewrites {
+		relation := "into"
+
+		if rw.Op == REWRITE_DROPPED {
+			relation = "by"
+		}
+
+		fmt.Fprintf(&b, "\n  #%d %s %s %s %s #%d", rw.ActionId, rw.Kind, rw.IRI, rw.Op, relation, rw.Into)
+	}
+
+	return b.String()
+}
+
+// SetOptimize runs the optimizer as part of Commit() and dry runs; the report is available from Optimized()
+func (c *Transaction) SetOptimize(enabled bool) {
+	c.optimize = enabled
+}
+
+// Optimized is the report of the optimizer pass run by the last Commit(), nil when none ran
+func (c *Transaction) Optimized() *OptimizeReport {
+	return c.optimized
+}
+
+// optimizer tracks, between two read checks, the writes that may still be merged or dropped
+type optimizer struct {
+	c       *Transaction
+	report  *OptimizeReport
+	dropped map[uint32]bool
+
+	writes   map[string][]uint32 // surviving writes by object IRI
+	creates  map[string]uint32   // NodeCreate by node ID
+	counters map[string]uint32   // increment that later increments merge into, by counter IRI
+}
+
+func (opt *optimizer) barrier() {
+	opt.writes = make(map[string][]uint32)
+	opt.creates = make(map[string]uint32)
+	opt.counters = make(map[string]uint32)
+}
+
+func (opt *optimizer) drop(op RewriteOp, aID uint32, iri string, into uint32) {
+	opt.dropped[aID] = true
+	opt.report.Rewrites = append(opt.report.Rewrites, Rewrite{Op: op, ActionId: aID, Kind: KindOf(opt.c.actions[aID]), IRI: iri, Into: into})
+}
+
+// upsert writes create their object when it is missing
+func upsert(kind ActionKind) bool {
+	switch kind {
+	case ACTION_EDGE_UPDATE, ACTION_INDEX_CREATE, ACTION_META_UPDATE:
+		return true
+	default:
+		return false
+	}
+}
+
+// supersede drops the writes a delete or clear of iri overrides; a clear's IRI ends with the wildcard. The
+// object may not exist before the first write, so a first upsert is kept: without it the delete could fail.
+func (opt *optimizer) supersede(iri string, by uint32) {
+	prefix := strings.TrimSuffix(iri, WILDCARD)
+
+	for key, ids := range opt.writes {
+		if key != iri && (prefix == iri || !strings.HasPrefix(key, prefix)) {
+			continue
+		}
+
+		for w, aID := range ids {
+			if w == 0 && upsert(KindOf(opt.c.actions[aID])) {
+				continue
+			}
+
+			opt.drop(REWRITE_DROPPED, aID, key, by)
+		}
+
+		delete(opt.writes, key)
+		delete(opt.counters, key)
+	}
+}
+
+// replace swaps in a private copy of an action, so merging does not modify objects owned by the caller
+func (opt *optimizer) replace(aID uint32) *pb.TransactionAction {
+	o := proto.Clone(opt.c.actions[aID]).(*pb.TransactionAction)
+	opt.c.actions[aID] = o
+
+	return o
+}
+
+func (opt *optimizer) action(aID uint32) {
+	o := opt.c.actions[aID]
+	iri, _ := describeAction(o)
+
+	switch tReq := o.Action.(type) {
+	case *pb.TransactionAction_ReadCheck:
+		opt.barrier()
+	case *pb.TransactionAction_NodeCreate:
+		opt.creates[tReq.NodeCreate.Id] = aID
+	case *pb.TransactionAction_NodeUpdate:
+		if cID, created := opt.creates[tReq.NodeUpdate.Id]; created {
+			// the create keeps the caller's node, so its other fields survive and it receives the real ID
+			opt.c.actions[cID].GetNodeCreate().Properties = tReq.NodeUpdate.Properties
+			opt.drop(REWRITE_FOLDED, aID, iri, cID)
+		} else {
+			opt.writes[iri] = append(opt.writes[iri], aID)
+		}
+	case *pb.TransactionAction_CounterIncrement:
+		if into, merging := opt.counters[iri]; merging {
+			opt.replace(into).GetCounterIncrement().Value += tReq.CounterIncrement.Value
+			opt.drop(REWRITE_MERGED, aID, iri, into)
+		} else {
+			opt.counters[iri] = aID
+			opt.writes[iri] = append(opt.writes[iri], aID)
+		}
+	case *pb.TransactionAction_CounterRegister:
+		delete(opt.counters, iri)
+	case *pb.TransactionAction_EdgeUpdate, *pb.TransactionAction_IndexCreate, *pb.TransactionAction_MetaUpdate:
+		opt.writes[iri] = append(opt.writes[iri], aID)
+	case *pb.TransactionAction_NodeDelete:
+		delete(opt.creates, tReq.NodeDelete.Id)
+		opt.supersede(iri, aID)
+	case *pb.TransactionAction_EdgeDelete, *pb.TransactionAction_EdgeClear, *pb.TransactionAction_IndexDelete,
+		*pb.TransactionAction_MetaDelete, *pb.TransactionAction_MetaClear, *pb.TransactionAction_CounterDelete:
+		opt.supersede(iri, aID)
+	}
+}
+
+// Optimize rewrites the queued actions without changing what the transaction does: increments of the same
+// counter are merged, updates of a node created in this transaction are folded into its NodeCreate, and
+// writes followed by a delete or clear of the same object are dropped, except the first upsert of an object
+// that may not exist yet. Nothing moves across a ReadCheck.
+// Handles of removed actions no longer point to an action.
+func (c *Transaction) Optimize() (*OptimizeReport, error) {
+	if state := c.State(); state != STATE_BUILDING {
+		return nil, &TransactionError{msg: fmt.Sprintf("cannot optimize a %s transaction", state), class: TRANSACTION_ERROR_STATE}
+	} else if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c.rewrite(), nil
+}
+
+func (c *Transaction) rewrite() *OptimizeReport {
+	opt := &optimizer{c: c, report: &OptimizeReport{Before: len(c.actionIDs)}, dropped: make(map[uint32]bool)}
+	opt.barrier()
+
+	for _, aID := range c.actionIDs {
+		opt.action(aID)
+	}
+
+	kept := make([]uint32, 0, len(c.actionIDs))
+
+	for _, aID := range c.actionIDs {
+		if opt.dropped[aID] {
+			delete(c.actions, aID)
+		} else {
+			kept = append(kept, aID)
+		}
+	}
+
+	c.actionIDs = kept
+	opt.report.After = len(kept)
+
+	sort.SliceStable(opt.report.Rewrites, func(i, j int) bool {
+		return opt.report.Rewrites[i].ActionId < opt.report.Rewrites[j].ActionId
+	})
+
+	return opt.report
+}
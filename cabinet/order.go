@@ -0,0 +1,235 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"container/heap"
+	"fmt"
+	"strings"
+)
+
+// actionGraph holds the ordering constraints between queued actions, by queue position
+type actionGraph struct {
+	ids   []uint32
+	next  [][]int
+	prev  [][]int
+	edges map[[2]int]bool
+}
+
+func (g *actionGraph) link(from int, to int) {
+	if from == to || g.edges[[2]int{from, to}] {
+		return
+	}
+
+	g.edges[[2]int{from, to}] = true
+	g.next[from] = append(g.next[from], to)
+	g.prev[to] = append(g.prev[to], from)
+}
+
+// objectKeys names what an action touches. Actions sharing a key keep the order they were queued in. The
+// NodeCreate of a temporary ID has no key: it is linked before every action using the ID instead.
+func objectKeys(o *pb.TransactionAction) []string {
+	keys := make([]string, 0)
+
+	for _, ref := range nodeRefs(o) {
+		keys = append(keys, "ref:"+*ref)
+	}
+
+	switch tReq := o.Action.(type) {
+	case *pb.TransactionAction_NodeCreate:
+		if !IsTmpID(tReq.NodeCreate.Id) {
+			keys = append(keys, "node:"+tReq.NodeCreate.Id)
+		}
+	case *pb.TransactionAction_NodeUpdate:
+		keys = append(keys, "node:"+tReq.NodeUpdate.Id)
+	case *pb.TransactionAction_NodeDelete:
+		keys = append(keys, "node:"+tReq.NodeDelete.Id)
+	}
+
+	return keys
+}
+
+// buildGraph links every NodeCreate of a temporary ID before the actions referencing it, keeps the queue order
+// of actions on the same node, and keeps read checks where they were queued relative to everything else
+func (c *Transaction) buildGraph() *actionGraph {
+	n := len(c.actionIDs)
+	g := &actionGraph{ids: c.actionIDs, next: make([][]int, n), prev: make([][]int, n), edges: make(map[[2]int]bool)}
+
+	creator := make(map[string]int)
+
+	for pos, aID := range c.actionIDs {
+		if tmpID, isCreate := c.tmpMap[aID]; isCreate {
+			if _, duplicate := creator[tmpID]; !duplicate {
+				creator[tmpID] = pos
+			}
+		}
+	}
+
+	lastTouch := make(map[string]int)
+	barrier := -1
+	sinceBarrier := make([]int, 0)
+
+	for pos, aID := range c.actionIDs {
+		o := c.actions[aID]
+
+		if KindOf(o) == ACTION_READ_CHECK {
+			for _, before := range sinceBarrier {
+				g.link(before, pos)
+			}
+
+			barrier = pos
+			sinceBarrier = sinceBarrier[:0]
+			continue
+		}
+
+		if barrier >= 0 {
+			g.link(barrier, pos)
+		}
+
+		sinceBarrier = append(sinceBarrier, pos)
+
+		for _, ref := range nodeRefs(o) {
+			if cPos, isCreated := creator[*ref]; isCreated {
+				g.link(cPos, pos)
+			}
+		}
+
+		for _, key := range objectKeys(o) {
+			if last, touched := lastTouch[key]; touched {
+				g.link(last, pos)
+			}
+
+			lastTouch[key] = pos
+		}
+	}
+
+	return g
+}
+
+// positionHeap pops the earliest queued action first, so unconstrained actions keep the caller's order
+type positionHeap []int
+
+func (h positionHeap) Len() int            { return len(h) }
+func (h positionHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h positionHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *positionHeap) Push(x interface{}) { *h = append(*h, x.(int)) }
+
+func (h *positionHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return x
+}
+
+// sort is a stable topological sort of the graph; the error describes one cycle when there is no valid order
+func (g *actionGraph) sort(c *Transaction) ([]uint32, *TransactionError) {
+	inDegree := make([]int, len(g.ids))
+	ready := &positionHeap{}
+
+	for pos := range g.ids {
+		inDegree[pos] = len(g.prev[pos])
+
+		if inDegree[pos] == 0 {
+			heap.Push(ready, pos)
+		}
+	}
+
+	order := make([]uint32, 0, len(g.ids))
+
+	for ready.Len() > 0 {
+		pos := heap.Pop(ready).(int)
+		order = append(order, g.ids[pos])
+
+		for _, to := range g.next[pos] {
+			inDegree[to] -= 1
+
+			if inDegree[to] == 0 {
+				heap.Push(ready, to)
+			}
+		}
+	}
+
+	if len(order) == len(g.ids) {
+		return order, nil
+	}
+
+	cycle := g.cycle(inDegree)
+	steps := make([]string, len(cycle))
+
+	for s, pos := range cycle {
+		steps[s] = fmt.Sprintf("action %d (%s)", g.ids[pos], KindOf(c.actions[g.ids[pos]]))
+	}
+
+	return nil, &TransactionError{
+		msg:      fmt.Sprintf("action %d: dependency cycle: %s", g.ids[cycle[0]], strings.Join(steps, " -> ")),
+		class:    TRANSACTION_ERROR_ORDER,
+		actionId: g.ids[cycle[0]],
+	}
+}
+
+// cycle walks back through unsorted predecessors until a position repeats
+func (g *actionGraph) cycle(inDegree []int) []int {
+	start := -1
+
+	for pos := range inDegree {
+		if inDegree[pos] > 0 {
+			start = pos
+			break
+		}
+	}
+
+	seen := make(map[int]int)
+	walk := make([]int, 0)
+
+	for pos := start; ; {
+		if at, repeated := seen[pos]; repeated {
+			walk = walk[at:]
+			break
+		}
+
+		seen[pos] = len(walk)
+		walk = append(walk, pos)
+
+		for _, from := range g.prev[pos] {
+			if inDegree[from] > 0 {
+				pos = from
+				break
+			}
+		}
+	}
+
+	// the walk went backwards; reverse it, starting from the earliest queued action
+	first := 0
+
+	for w := range walk {
+		if walk[w] < walk[first] {
+			first = w
+		}
+	}
+
+	loop := make([]int, 0, len(walk)+1)
+
+	for w := 0; w <= len(walk); w++ {
+		loop = append(loop, walk[(first-w+len(walk))%len(walk)])
+	}
+
+	return loop
+}
+
+// Order is the sequence actions are sent in: the queue order, except that actions referencing a temporary ID
+// are moved after the NodeCreate introducing it
+func (c *Transaction) Order() ([]uint32, error) {
+	order, err := c.buildGraph().sort(c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
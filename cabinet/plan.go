@@ -0,0 +1,300 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet/iri"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// TmpLink is a temporary ID used by an action and the action creating it
+type TmpLink struct {
+	TmpID    string `json:"tmp_id"`
+	ActionId uint32 `json:"action_id"`
+}
+
+type PlanStep struct {
+	ActionId uint32     `json:"action_id"`
+	Kind     ActionKind `json:"kind"`
+	IRI      string     `json:"iri"`
+	Check    string     `json:"check,omitempty"` // operator and target of a ReadCheck
+	Payload  int        `json:"payload"`         // properties or value bytes
+	Bytes    int        `json:"bytes"`           // encoded action size
+	Creates  string     `json:"creates,omitempty"`
+	Uses     []TmpLink  `json:"uses,omitempty"`
+	Chunk    int        `json:"chunk"` // -1 without chunking
+}
+
+// TransactionPlan lists the queued actions in send order
+type TransactionPlan struct {
+	Steps  []*PlanStep `json:"steps"`
+	Bytes  int         `json:"bytes"`
+	Chunks int         `json:"chunks"`
+}
+
+func (k ActionKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func edgeIRI(e *pb.Edge) string {
+	return iri.EdgeOf(e).String()
+}
+
+func metaIRI(m *pb.Meta) string {
+	if object := iri.MetaOf(m); object != nil {
+		return object.String()
+	}
+
+	return "m/?"
+}
+
+func counterIRI(s *pb.Counter) string {
+	if object := iri.CounterOf(s); object != nil {
+		return object.String()
+	}
+
+	return "c/?"
+}
+
+// describeAction returns the IRI an action writes to and the size of its payload
+func describeAction(o *pb.TransactionAction) (string, int) {
+	var node *pb.Node
+	var edge *pb.Edge
+	var index *pb.Index
+	var meta *pb.Meta
+	var counter *pb.Counter
+
+	switch tReq := o.Action.(type) {
+	case *pb.TransactionAction_NodeCreate:
+		node = tReq.NodeCreate
+	case *pb.TransactionAction_NodeUpdate:
+		node = tReq.NodeUpdate
+	case *pb.TransactionAction_NodeDelete:
+		node = tReq.NodeDelete
+	case *pb.TransactionAction_EdgeUpdate:
+		edge = tReq.EdgeUpdate
+	case *pb.TransactionAction_EdgeDelete:
+		edge = tReq.EdgeDelete
+	case *pb.TransactionAction_EdgeClear:
+		edge = tReq.EdgeClear
+	case *pb.TransactionAction_IndexCreate:
+		index = tReq.IndexCreate
+	case *pb.TransactionAction_IndexDelete:
+		index = tReq.IndexDelete
+	case *pb.TransactionAction_MetaUpdate:
+		meta = tReq.MetaUpdate
+	case *pb.TransactionAction_MetaDelete:
+		meta = tReq.MetaDelete
+	case *pb.TransactionAction_MetaClear:
+		meta = tReq.MetaClear
+	case *pb.TransactionAction_CounterRegister:
+		counter = tReq.CounterRegister
+	case *pb.TransactionAction_CounterIncrement:
+		counter = tReq.CounterIncrement
+	case *pb.TransactionAction_CounterDelete:
+		counter = tReq.CounterDelete
+	case *pb.TransactionAction_ReadCheck:
+		if tReq.ReadCheck != nil {
+			return tReq.ReadCheck.Source, 0
+		}
+	}
+
+	switch {
+	case node != nil:
+		return iri.NodeOf(node).String(), len(node.Properties)
+	case edge != nil:
+		return edgeIRI(edge), len(edge.Properties)
+	case index != nil:
+		return iri.IndexOf(index).String(), len(index.Properties)
+	case meta != nil:
+		return metaIRI(meta), len(meta.Val)
+	case counter != nil:
+		return counterIRI(counter), 0
+	default:
+		return "", 0
+	}
+}
+
+func describeCheck(r *pb.ReadCheckRequest) string {
+	switch t := r.Target.GetTarget().(type) {
+	case *pb.CheckTarget_Val:
+		return fmt.Sprintf("%s %q", r.Operator, t.Val)
+	case *pb.CheckTarget_Iri:
+		return fmt.Sprintf("%s %s", r.Operator, t.Iri)
+	default:
+		return r.Operator.String()
+	}
+}
+
+// Plan describes what Commit() would send, in send order. Actions already committed by an earlier chunked
+// commit are left out.
+func (c *Transaction) Plan() (*TransactionPlan, error) {
+	order, err := c.Order()
+
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]uint32, 0, len(order))
+
+	for _, aID := range order {
+		if !c.committed[aID] {
+			pending = append(pending, aID)
+		}
+	}
+
+	chunkOf := make(map[uint32]int)
+	plan := &TransactionPlan{Steps: make([]*PlanStep, 0, len(pending)), Chunks: 1}
+
+	if c.chunking != nil {
+		if problems := c.chunkProblems(pending); len(problems) > 0 {
+			return nil, &ValidationError{Problems: problems}
+		}
+
+		chunks := c.splitChunks(pending)
+
+		plan.Chunks = len(chunks)
+
+		for _, chunk := range chunks {
+			for _, aID := range chunk.ActionIDs {
+				chunkOf[aID] = chunk.Index
+			}
+		}
+	}
+
+	creator := make(map[string]uint32)
+
+	for _, aID := range c.actionIDs {
+		if tmpID, isCreate := c.tmpMap[aID]; isCreate {
+			if _, duplicate := creator[tmpID]; !duplicate {
+				creator[tmpID] = aID
+			}
+		}
+	}
+
+	for _, aID := range pending {
+		o := c.actions[aID]
+		objectIRI, payload := describeAction(o)
+
+		step := &PlanStep{
+			ActionId: aID,
+			Kind:     KindOf(o),
+			IRI:      objectIRI,
+			Payload:  payload,
+			Bytes:    proto.Size(o),
+			Creates:  c.tmpMap[aID],
+			Chunk:    -1,
+		}
+
+		if rc, isCheck := o.Action.(*pb.TransactionAction_ReadCheck); isCheck && rc.ReadCheck != nil {
+			step.Check = describeCheck(rc.ReadCheck)
+		}
+
+		for _, ref := range nodeRefs(o) {
+			if IsTmpID(*ref) {
+				step.Uses = append(step.Uses, TmpLink{TmpID: *ref, ActionId: creator[*ref]})
+			}
+		}
+
+		if chunk, isChunked := chunkOf[aID]; isChunked {
+			step.Chunk = chunk
+		}
+
+		plan.Steps = append(plan.Steps, step)
+		plan.Bytes += step.Bytes
+	}
+
+	return plan, nil
+}
+
+func (p *TransactionPlan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d action(s), %d bytes, %d chunk(s)\n", len(p.Steps), p.Bytes, p.Chunks)
+
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+
+	for _, step := range p.Steps {
+		links := make([]string, 0)
+
+		if step.Creates != "" {
+			links = append(links, "creates "+step.Creates)
+		}
+
+		for _, use := range step.Uses {
+			links = append(links, fmt.Sprintf("uses %s from #%d", use.TmpID, use.ActionId))
+		}
+
+		if step.Check != "" {
+			links = append(links, step.Check)
+		}
+
+		chunk := ""
+
+		if step.Chunk >= 0 {
+			chunk = fmt.Sprintf("[%d]", step.Chunk)
+		}
+
+		fmt.Fprintf(w, "%s\t#%d\t%s\t%s\t%dB/%dB\t%s\n", chunk, step.ActionId, step.Kind, step.IRI, step.Payload, step.Bytes, strings.Join(links, ", "))
+	}
+
+	w.Flush()
+	return b.String()
+}
+
+func (p *TransactionPlan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// SetDryRun makes Commit() validate and write the plan to w instead of opening the stream; nil disables it.
+// A dry run leaves the transaction state unchanged.
+func (c *Transaction) SetDryRun(w io.Writer) {
+	c.dryRun = w
+}
+
+// optimizerCopy deep-copies the queued actions under their IDs, so a dry run can optimize them without
+// rewriting the transaction or the caller's objects
+func (c *Transaction) optimizerCopy() *Transaction {
+	o := &Transaction{}
+	o.Setup(c.ctx, c.client)
+	o.chunking = c.chunking
+	o.actPos = c.actPos
+
+	for _, aID := range c.actionIDs {
+		o.actions[aID] = proto.Clone(c.actions[aID]).(*pb.TransactionAction)
+		o.actionIDs = append(o.actionIDs, aID)
+
+		if tmpID, isCreate := c.tmpMap[aID]; isCreate {
+			o.tmpMap[aID] = tmpID
+		}
+	}
+
+	return o
+}
+
+func (c *Transaction) dryRunCommit() error {
+	planned := c
+
+	if c.optimize && len(c.committed) == 0 {
+		planned = c.optimizerCopy()
+		c.optimized = planned.rewrite()
+	}
+
+	plan, err := planned.Plan()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(c.dryRun, plan.String())
+	return err
+}
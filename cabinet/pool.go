@@ -0,0 +1,209 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	ErrPoolClosed = errors.New("pool is closed")
+	ErrPoolFull   = errors.New("pool queue is full")
+)
+
+type poolJob struct {
+	future *CommitFuture
+	ctx    context.Context
+}
+
+// Pool commits transactions with a fixed number of workers. At most queue jobs wait for a worker; Submit()
+// blocks while the queue is full.
+type Pool struct {
+	queue   chan *poolJob
+	quit    chan struct{}
+	sendMux sync.RWMutex // held by submitters, so Close() never closes the queue under a send
+	workers sync.WaitGroup
+
+	pending map[*CommitFuture]bool
+	mux     sync.Mutex
+
+	client pb.CDSCabinetClient
+	ctx    context.Context
+}
+
+// NewPool starts workers; ctx and cli are used for the transactions built by SubmitActions()
+func NewPool(ctx context.Context, cli pb.CDSCabinetClient, workers int, queue int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	if queue < 0 {
+		queue = 0
+	}
+
+	p := &Pool{
+		queue:   make(chan *poolJob, queue),
+		quit:    make(chan struct{}),
+		pending: make(map[*CommitFuture]bool),
+		client:  cli,
+		ctx:     ctx,
+	}
+
+	p.workers.Add(workers)
+
+	for w := 0; w < workers; w++ {
+		go p.work()
+	}
+
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.workers.Done()
+
+	for j := range p.queue {
+		f := j.future
+
+		if err := j.ctx.Err(); err != nil {
+			f.err = canceledError(err)
+		} else {
+			f.err = f.trx.CommitContext(j.ctx)
+		}
+
+		p.forget(j)
+		close(f.done)
+	}
+}
+
+func (p *Pool) isClosed() bool {
+	select {
+	case <-p.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// job tracks a new pending commit of trx
+func (p *Pool) job(trx *Transaction) *poolJob {
+	ctx, cancel := context.WithCancel(trx.ctx)
+	j := &poolJob{future: &CommitFuture{trx: trx, done: make(chan struct{}), cancel: cancel}, ctx: ctx}
+
+	p.mux.Lock()
+	p.pending[j.future] = true
+	p.mux.Unlock()
+
+	return j
+}
+
+func (p *Pool) forget(j *poolJob) {
+	j.future.cancel()
+
+	p.mux.Lock()
+	delete(p.pending, j.future)
+	p.mux.Unlock()
+}
+
+// Submit queues trx, waiting for room in the queue until ctx is done or the pool closes. Cancelling the
+// returned future aborts the commit, or skips it when it has not started yet.
+func (p *Pool) Submit(ctx context.Context, trx *Transaction) (*CommitFuture, error) {
+	p.sendMux.RLock()
+	defer p.sendMux.RUnlock()
+
+	if p.isClosed() {
+		return nil, ErrPoolClosed
+	}
+
+	j := p.job(trx)
+
+	select {
+	case p.queue <- j:
+		return j.future, nil
+	case <-ctx.Done():
+		p.forget(j)
+		return nil, ctx.Err()
+	case <-p.quit:
+		p.forget(j)
+		return nil, ErrPoolClosed
+	}
+}
+
+// TrySubmit queues trx without waiting, failing with ErrPoolFull when the queue has no room
+func (p *Pool) TrySubmit(trx *Transaction) (*CommitFuture, error) {
+	p.sendMux.RLock()
+	defer p.sendMux.RUnlock()
+
+	if p.isClosed() {
+		return nil, ErrPoolClosed
+	}
+
+	j := p.job(trx)
+
+	select {
+	case p.queue <- j:
+		return j.future, nil
+	default:
+		p.forget(j)
+		return nil, ErrPoolFull
+	}
+}
+
+// SubmitActions commits actions as one new transaction
+func (p *Pool) SubmitActions(ctx context.Context, actions ...*pb.TransactionAction) (*CommitFuture, error) {
+	trx := &Transaction{}
+	trx.Setup(p.ctx, p.client)
+
+	for _, o := range actions {
+		trx.O(o)
+	}
+
+	return p.Submit(ctx, trx)
+}
+
+// Close stops accepting jobs and waits for the queued and running commits to finish. If ctx ends first,
+// the remaining commits are cancelled and Close returns once the workers have stopped.
+func (p *Pool) Close(ctx context.Context) error {
+	p.mux.Lock()
+
+	if p.isClosed() {
+		p.mux.Unlock()
+		return ErrPoolClosed
+	}
+
+	close(p.quit)
+	p.mux.Unlock()
+
+	// submitters blocked on a full queue give up once quit is closed
+	p.sendMux.Lock()
+	close(p.queue)
+	p.sendMux.Unlock()
+
+	drained := make(chan struct{})
+
+	go func() {
+		p.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mux.Lock()
+	for f := range p.pending {
+		f.cancel()
+	}
+	p.mux.Unlock()
+
+	<-drained
+	return ctx.Err()
+}
@@ -0,0 +1,176 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+)
+
+// ActionResult pairs a queued action with the response received for it, if any
+type ActionResult struct {
+	ActionId uint32
+	Kind     ActionKind
+	Action   *pb.TransactionAction
+	Response *pb.TransactionActionResponse
+}
+
+func (r *ActionResult) Done() bool {
+	return r.Response != nil
+}
+
+// CreatedNodeID is the real ID assigned by the server to a committed NodeCreate
+func (r *ActionResult) CreatedNodeID() (string, bool) {
+	if nc, isCreate := r.Response.GetResponse().(*pb.TransactionActionResponse_NodeCreate); isCreate && nc.NodeCreate != nil {
+		return nc.NodeCreate.Id, true
+	}
+
+	return "", false
+}
+
+// Node is the node applied by a NodeCreate, NodeUpdate or NodeDelete, nil for other kinds
+func (r *ActionResult) Node() *pb.Node {
+	switch tReq := r.Action.GetAction().(type) {
+	case *pb.TransactionAction_NodeCreate:
+		return tReq.NodeCreate
+	case *pb.TransactionAction_NodeUpdate:
+		return tReq.NodeUpdate
+	case *pb.TransactionAction_NodeDelete:
+		return tReq.NodeDelete
+	default:
+		return nil
+	}
+}
+
+// Edge is the edge applied by an EdgeUpdate, EdgeDelete or EdgeClear, nil for other kinds
+func (r *ActionResult) Edge() *pb.Edge {
+	switch tReq := r.Action.GetAction().(type) {
+	case *pb.TransactionAction_EdgeUpdate:
+		return tReq.EdgeUpdate
+	case *pb.TransactionAction_EdgeDelete:
+		return tReq.EdgeDelete
+	case *pb.TransactionAction_EdgeClear:
+		return tReq.EdgeClear
+	default:
+		return nil
+	}
+}
+
+// Index is the index applied by an IndexCreate or IndexDelete, nil for other kinds
+func (r *ActionResult) Index() *pb.Index {
+	switch tReq := r.Action.GetAction().(type) {
+	case *pb.TransactionAction_IndexCreate:
+		return tReq.IndexCreate
+	case *pb.TransactionAction_IndexDelete:
+		return tReq.IndexDelete
+	default:
+		return nil
+	}
+}
+
+// Meta is the meta applied by a MetaUpdate, MetaDelete or MetaClear, nil for other kinds
+func (r *ActionResult) Meta() *pb.Meta {
+	switch tReq := r.Action.GetAction().(type) {
+	case *pb.TransactionAction_MetaUpdate:
+		return tReq.MetaUpdate
+	case *pb.TransactionAction_MetaDelete:
+		return tReq.MetaDelete
+	case *pb.TransactionAction_MetaClear:
+		return tReq.MetaClear
+	default:
+		return nil
+	}
+}
+
+// Counter is the counter applied by a CounterRegister, CounterIncrement or CounterDelete, nil for other kinds
+func (r *ActionResult) Counter() *pb.Counter {
+	switch tReq := r.Action.GetAction().(type) {
+	case *pb.TransactionAction_CounterRegister:
+		return tReq.CounterRegister
+	case *pb.TransactionAction_CounterIncrement:
+		return tReq.CounterIncrement
+	case *pb.TransactionAction_CounterDelete:
+		return tReq.CounterDelete
+	default:
+		return nil
+	}
+}
+
+// ReadCheck is the check performed by a ReadCheck action, which passed when Done() is true
+func (r *ActionResult) ReadCheck() *pb.ReadCheckRequest {
+	if rc, isCheck := r.Action.GetAction().(*pb.TransactionAction_ReadCheck); isCheck {
+		return rc.ReadCheck
+	}
+
+	return nil
+}
+
+// Response is the server response for actionID, nil if none was received
+func (c *Transaction) Response(actionID uint32) *pb.TransactionActionResponse {
+	c.resMux.Lock()
+	defer c.resMux.Unlock()
+
+	return c.response[actionID]
+}
+
+// Result is the ActionResult for actionID, nil when the action is not part of the transaction
+func (c *Transaction) Result(actionID uint32) *ActionResult {
+	o, queued := c.actions[actionID]
+
+	if !queued {
+		return nil
+	}
+
+	return &ActionResult{ActionId: actionID, Kind: KindOf(o), Action: o, Response: c.Response(actionID)}
+}
+
+// Results lists every action with its response, in queue order; Order() gives the send order
+func (c *Transaction) Results() []*ActionResult {
+	results := make([]*ActionResult, 0, len(c.actionIDs))
+
+	for _, aID := range c.actionIDs {
+		results = append(results, c.Result(aID))
+	}
+
+	return results
+}
+
+// Responses lists the received responses in queue order
+func (c *Transaction) Responses() []*pb.TransactionActionResponse {
+	c.resMux.Lock()
+	defer c.resMux.Unlock()
+
+	responses := make([]*pb.TransactionActionResponse, 0, len(c.response))
+
+	for _, aID := range c.actionIDs {
+		if r, received := c.response[aID]; received {
+			responses = append(responses, r)
+		}
+	}
+
+	return responses
+}
+
+// EachResult walks the actions in queue order until fn returns false
+func (c *Transaction) EachResult(fn func(r *ActionResult) bool) {
+	for _, aID := range c.actionIDs {
+		if !fn(c.Result(aID)) {
+			return
+		}
+	}
+}
+
+func (h *ActionHandle) Response() *pb.TransactionActionResponse {
+	return h.trx.Response(h.id)
+}
+
+func (h *ActionHandle) Result() *ActionResult {
+	return h.trx.Result(h.id)
+}
+
+func (h *ActionHandle) Done() bool {
+	return h.Response() != nil
+}
@@ -0,0 +1,145 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"math"
+	"math/rand"
+	"time"
+)
+
+type RetryPolicy struct {
+	MaxAttempts    int // including the first one
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64 // fraction of the backoff that is randomised, 0..1
+	RetryableCodes []codes.Code
+}
+
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableCodes: []codes.Code{codes.Unavailable},
+	}
+}
+
+// backoff is the wait before the given attempt (2 for the first retry)
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	wait := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-2))
+
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		wait += wait * p.Jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(wait)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	for _, code := range p.RetryableCodes {
+		if errors.Is(err, &CabinetError{Status: code}) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// idempotent actions leave the same state when applied twice
+func idempotent(o *pb.TransactionAction) bool {
+	switch KindOf(o) {
+	case ACTION_EDGE_UPDATE, ACTION_META_UPDATE,
+		ACTION_NODE_DELETE, ACTION_EDGE_DELETE, ACTION_INDEX_DELETE, ACTION_META_DELETE, ACTION_COUNTER_DELETE,
+		ACTION_EDGE_CLEAR, ACTION_META_CLEAR, ACTION_READ_CHECK:
+		return true
+	default:
+		return false
+	}
+}
+
+// canReplay is true when nothing in ids was acknowledged yet or when replaying cannot apply anything twice
+func (c *Transaction) canReplay(ids []uint32) bool {
+	received := 0
+
+	c.resMux.Lock()
+	for _, aID := range ids {
+		if _, isReceived := c.response[aID]; isReceived {
+			received += 1
+		}
+	}
+	c.resMux.Unlock()
+
+	if received == 0 {
+		return true
+	}
+
+	for _, aID := range ids {
+		if !idempotent(c.actions[aID]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *Transaction) SetRetryPolicy(p *RetryPolicy) {
+	c.retry = p
+}
+
+// Attempts is the number of transaction streams opened by the last Commit(), across all chunks
+func (c *Transaction) Attempts() int {
+	return c.attempts
+}
+
+// clearResponses forgets what a failed attempt received for ids
+func (c *Transaction) clearResponses(ids []uint32) {
+	c.resMux.Lock()
+	for _, aID := range ids {
+		delete(c.response, aID)
+	}
+	c.resMux.Unlock()
+
+	c.mapMux.Lock()
+	for _, aID := range ids {
+		delete(c.idMap, c.tmpMap[aID])
+	}
+	c.mapMux.Unlock()
+}
+
+// commitWithRetry runs commitOnce for ids until it succeeds or the policy gives up
+func (c *Transaction) commitWithRetry(ctx context.Context, ids []uint32) error {
+	for try := 1; ; try++ {
+		c.attempts += 1
+		err := c.commitOnce(ctx, ids)
+
+		if err == nil || c.retry == nil || try >= c.retry.MaxAttempts {
+			return err
+		} else if !c.retry.retryable(err) || !c.canReplay(ids) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(c.retry.backoff(try + 1)):
+		}
+
+		c.clearResponses(ids)
+	}
+}
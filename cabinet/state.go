@@ -0,0 +1,121 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+)
+
+type TransactionState uint8
+
+const (
+	STATE_BUILDING TransactionState = iota
+	STATE_COMMITTING
+	STATE_COMMITTED
+	STATE_FAILED
+)
+
+var transactionStateNames = map[TransactionState]string{
+	STATE_BUILDING:   "building",
+	STATE_COMMITTING: "committing",
+	STATE_COMMITTED:  "committed",
+	STATE_FAILED:     "failed",
+}
+
+func (s TransactionState) String() string {
+	if name, known := transactionStateNames[s]; known {
+		return name
+	}
+
+	return fmt.Sprintf("TransactionState(%d)", uint8(s))
+}
+
+func (c *Transaction) State() TransactionState {
+	c.stateMux.Lock()
+	defer c.stateMux.Unlock()
+
+	return c.state
+}
+
+func (c *Transaction) setState(s TransactionState) {
+	c.stateMux.Lock()
+	c.state = s
+	c.stateMux.Unlock()
+}
+
+// beginCommit moves a building (or failed) transaction to committing, refusing concurrent or repeated commits
+func (c *Transaction) beginCommit() error {
+	c.stateMux.Lock()
+	defer c.stateMux.Unlock()
+
+	if c.state == STATE_COMMITTING || c.state == STATE_COMMITTED {
+		return &TransactionError{msg: fmt.Sprintf("transaction is %s; Reset() or Clone() it first", c.state), class: TRANSACTION_ERROR_STATE}
+	}
+
+	c.state = STATE_COMMITTING
+	return nil
+}
+
+// Reset drops all actions, responses, ID maps and what the last commit recorded (chunks, attempts, undo log and
+// optimizer report), keeping the client, context, retry policy and other options
+func (c *Transaction) Reset() {
+	c.init()
+}
+
+// Clone copies the queued actions, with their original temporary IDs, into a new building transaction with the
+// same options. The retry policy, chunk policy, dry run writer and hooks are shared.
+func (c *Transaction) Clone() *Transaction {
+	n := &Transaction{}
+	n.Setup(c.ctx, c.client)
+	n.retry = c.retry
+	n.hooks = append(n.hooks, c.hooks...)
+	n.chunking = c.chunking
+	n.dryRun = c.dryRun
+	n.undoEnabled = c.undoEnabled
+	n.optimize = c.optimize
+
+	for _, o := range c.pristineActions() {
+		n.Operation(*o)
+	}
+
+	n.actPos = c.actPos
+	return n
+}
+
+// pristineActions deep-copies the queued actions in queue order, as they were before commit rewrote them
+func (c *Transaction) pristineActions() []*pb.TransactionAction {
+	c.mapMux.Lock()
+	realToTmp := make(map[string]string)
+
+	for tmpID, realID := range c.idMap {
+		realToTmp[realID] = tmpID
+	}
+	c.mapMux.Unlock()
+
+	actions := make([]*pb.TransactionAction, 0, len(c.actionIDs))
+
+	for _, aID := range c.actionIDs {
+		o := proto.Clone(c.actions[aID]).(*pb.TransactionAction)
+
+		// committed actions were rewritten with real IDs; restore the temporary ones
+		if nc, isCreate := o.Action.(*pb.TransactionAction_NodeCreate); isCreate && c.tmpMap[aID] != "" {
+			nc.NodeCreate.Id = c.tmpMap[aID]
+		}
+
+		for _, ref := range nodeRefs(o) {
+			if tmpID, mapped := realToTmp[*ref]; mapped {
+				*ref = tmpID
+			}
+		}
+
+		actions = append(actions, o)
+	}
+
+	return actions
+}
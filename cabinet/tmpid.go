@@ -0,0 +1,159 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"fmt"
+	"strings"
+)
+
+const TMP_ID_PREFIX = "tmp:"
+
+func IsTmpID(id string) bool {
+	return strings.HasPrefix(id, TMP_ID_PREFIX)
+}
+
+// createdTmpID is the temporary ID a NodeCreate introduces, empty for anything else
+func createdTmpID(o *pb.TransactionAction) string {
+	if nc, isCreate := o.Action.(*pb.TransactionAction_NodeCreate); isCreate && IsTmpID(nc.NodeCreate.Id) {
+		return nc.NodeCreate.Id
+	}
+
+	return ""
+}
+
+// nodeRefs lists every node ID field an action points to, so they can be checked and rewritten in place.
+// The ID introduced by a NodeCreate is not a reference.
+func nodeRefs(o *pb.TransactionAction) []*string {
+	switch tReq := o.Action.(type) {
+	case *pb.TransactionAction_NodeUpdate:
+		return []*string{&tReq.NodeUpdate.Id}
+	case *pb.TransactionAction_NodeDelete:
+		return []*string{&tReq.NodeDelete.Id}
+	case *pb.TransactionAction_EdgeUpdate:
+		return edgeRefs(tReq.EdgeUpdate)
+	case *pb.TransactionAction_EdgeDelete:
+		return edgeRefs(tReq.EdgeDelete)
+	case *pb.TransactionAction_EdgeClear:
+		return edgeRefs(tReq.EdgeClear)
+	case *pb.TransactionAction_IndexCreate:
+		return []*string{&tReq.IndexCreate.Node}
+	case *pb.TransactionAction_IndexDelete:
+		return []*string{&tReq.IndexDelete.Node}
+	case *pb.TransactionAction_MetaUpdate:
+		return metaRefs(tReq.MetaUpdate)
+	case *pb.TransactionAction_MetaDelete:
+		return metaRefs(tReq.MetaDelete)
+	case *pb.TransactionAction_MetaClear:
+		return metaRefs(tReq.MetaClear)
+	case *pb.TransactionAction_CounterRegister:
+		return counterRefs(tReq.CounterRegister)
+	case *pb.TransactionAction_CounterIncrement:
+		return counterRefs(tReq.CounterIncrement)
+	case *pb.TransactionAction_CounterDelete:
+		return counterRefs(tReq.CounterDelete)
+	default:
+		return nil
+	}
+}
+
+func edgeRefs(e *pb.Edge) []*string {
+	if e == nil {
+		return nil
+	}
+
+	return []*string{&e.Subject, &e.Target}
+}
+
+func metaRefs(m *pb.Meta) []*string {
+	if m == nil {
+		return nil
+	}
+
+	switch mo := m.Object.(type) {
+	case *pb.Meta_Node:
+		return []*string{&mo.Node}
+	case *pb.Meta_Edge:
+		return edgeRefs(mo.Edge)
+	default:
+		return nil
+	}
+}
+
+func counterRefs(s *pb.Counter) []*string {
+	if s == nil {
+		return nil
+	}
+
+	switch so := s.Object.(type) {
+	case *pb.Counter_Node:
+		return []*string{&so.Node}
+	case *pb.Counter_Edge:
+		return edgeRefs(so.Edge)
+	default:
+		return nil
+	}
+}
+
+// tmpRefProblems reports temporary IDs that are referenced but never created, or created more than once
+func (c *Transaction) tmpRefProblems() []*TransactionError {
+	problems := make([]*TransactionError, 0)
+	created := make(map[string]uint32)
+
+	for _, aID := range c.actionIDs {
+		tmpID, isCreate := c.tmpMap[aID]
+
+		if !isCreate {
+			continue
+		}
+
+		if firstID, duplicate := created[tmpID]; duplicate {
+			problems = append(problems, &TransactionError{
+				msg:      fmt.Sprintf("action %d: %s is already created by action %d", aID, tmpID, firstID),
+				class:    TRANSACTION_ERROR_TMP_ID,
+				actionId: aID,
+			})
+		} else {
+			created[tmpID] = aID
+		}
+	}
+
+	for _, aID := range c.actionIDs {
+		for _, ref := range nodeRefs(c.actions[aID]) {
+			if _, isCreated := created[*ref]; IsTmpID(*ref) && !isCreated {
+				problems = append(problems, &TransactionError{
+					msg:      fmt.Sprintf("action %d: %s is not created in this transaction", aID, *ref),
+					class:    TRANSACTION_ERROR_TMP_ID,
+					actionId: aID,
+				})
+			}
+		}
+	}
+
+	return problems
+}
+
+// resolveTmpIDs rewrites the queued objects with the real IDs received from the server
+func (c *Transaction) resolveTmpIDs() {
+	c.mapMux.Lock()
+	defer c.mapMux.Unlock()
+
+	for _, aID := range c.actionIDs {
+		if nc, isCreate := c.actions[aID].Action.(*pb.TransactionAction_NodeCreate); isCreate {
+			if realID, mapped := c.idMap[nc.NodeCreate.Id]; mapped {
+				nc.NodeCreate.Id = realID
+			}
+		}
+
+		for _, ref := range nodeRefs(c.actions[aID]) {
+			if realID, mapped := c.idMap[*ref]; mapped {
+				*ref = realID
+			}
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type SpanEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]interface{}
+}
+
+// Span is one timed operation: a commit or a CDSCabinetClient call
+type Span struct {
+	TraceID  string
+	SpanID   string
+	ParentID string
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Err      error
+
+	Attributes map[string]interface{}
+	Events     []SpanEvent
+
+	mux sync.Mutex
+}
+
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mux.Lock()
+	s.Attributes[key] = value
+	s.mux.Unlock()
+}
+
+func (s *Span) AddEvent(name string, attributes map[string]interface{}) {
+	s.mux.Lock()
+	s.Events = append(s.Events, SpanEvent{Name: name, Time: time.Now(), Attributes: attributes})
+	s.mux.Unlock()
+}
+
+// SpanExporter receives every span once it has ended
+type SpanExporter interface {
+	Export(span *Span)
+}
+
+// InMemoryExporter keeps the exported spans, for tests and debugging
+type InMemoryExporter struct {
+	mux   sync.Mutex
+	spans []*Span
+}
+
+func (e *InMemoryExporter) Export(span *Span) {
+	e.mux.Lock()
+	e.spans = append(e.spans, span)
+	e.mux.Unlock()
+}
+
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	return append([]*Span(nil), e.spans...)
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mux.Lock()
+	e.spans = nil
+	e.mux.Unlock()
+}
+
+type Tracer struct {
+	exporter SpanExporter
+}
+
+func NewTracer(exporter SpanExporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+type spanContextKey struct{}
+
+// SpanFromContext is the span started by a Tracer for ctx, nil outside of one
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+func newSpanID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// Start opens a child of the span in ctx, or a new trace
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	span := &Span{SpanID: newSpanID(8), Name: name, Start: time.Now(), Attributes: make(map[string]interface{})}
+
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else {
+		span.TraceID = newSpanID(16)
+	}
+
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// Finish ends span with err and hands it to the exporter
+func (t *Tracer) Finish(span *Span, err error) {
+	span.mux.Lock()
+	span.End = time.Now()
+	span.Err = err
+	span.mux.Unlock()
+
+	t.exporter.Export(span)
+}
+
+// commitTrace remembers when each action of the current attempt was sent
+type commitTrace struct {
+	mux  sync.Mutex
+	sent map[uint32]time.Time
+}
+
+type commitTraceKey struct{}
+
+// Hooks traces Commit(): one span per commit, with an event per action response carrying its kind, IRI,
+// payload size and latency since it was sent
+func (t *Tracer) Hooks() *Hooks {
+	return &Hooks{
+		AroundCommit: func(ctx context.Context, trx *Transaction, next CommitFunc) error {
+			ctx, span := t.Start(ctx, "cabinet.Transaction/Commit")
+			ctx = context.WithValue(ctx, commitTraceKey{}, &commitTrace{sent: make(map[uint32]time.Time)})
+
+			err := next(ctx)
+
+			span.SetAttribute("actions", len(trx.actionIDs))
+			span.SetAttribute("attempts", trx.Attempts())
+			span.SetAttribute("chunks", len(trx.Chunks()))
+			span.SetAttribute("state", trx.State().String())
+
+			t.Finish(span, err)
+			return err
+		},
+		BeforeSend: func(ctx context.Context, o *pb.TransactionAction) error {
+			if ct, traced := ctx.Value(commitTraceKey{}).(*commitTrace); traced {
+				ct.mux.Lock()
+				ct.sent[o.ActionId] = time.Now()
+				ct.mux.Unlock()
+			}
+
+			return nil
+		},
+		AfterResponse: func(ctx context.Context, o *pb.TransactionAction, r *pb.TransactionActionResponse) {
+			span := SpanFromContext(ctx)
+			ct, traced := ctx.Value(commitTraceKey{}).(*commitTrace)
+
+			if span == nil || !traced {
+				return
+			}
+
+			iri, payload := describeAction(o)
+			attributes := map[string]interface{}{"action_id": r.ActionId, "kind": KindOf(o).String(), "iri": iri, "payload": payload}
+
+			ct.mux.Lock()
+			if sent, isSent := ct.sent[r.ActionId]; isSent {
+				attributes["latency"] = time.Since(sent)
+			}
+			ct.mux.Unlock()
+
+			span.AddEvent("response", attributes)
+		},
+	}
+}
+
+func messageSize(m interface{}) int {
+	if pm, isProto := m.(proto.Message); isProto {
+		return proto.Size(pm)
+	}
+
+	return 0
+}
+
+// UnaryClientInterceptor traces every unary CDSCabinetClient call; install with grpc.WithUnaryInterceptor
+func (t *Tracer) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := t.Start(ctx, method)
+		span.SetAttribute("request_bytes", messageSize(req))
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		span.SetAttribute("status", status.Code(err).String())
+
+		if err == nil {
+			span.SetAttribute("response_bytes", messageSize(reply))
+		}
+
+		t.Finish(span, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor traces streaming calls, such as the transaction stream, until they end
+func (t *Tracer) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := t.Start(ctx, method)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+
+		if err != nil {
+			span.SetAttribute("status", status.Code(err).String())
+			t.Finish(span, err)
+
+			return nil, err
+		}
+
+		return &tracedStream{ClientStream: stream, tracer: t, span: span}, nil
+	}
+}
+
+// tracedStream counts messages atomically: SendMsg and RecvMsg run on different goroutines
+type tracedStream struct {
+	grpc.ClientStream
+
+	tracer   *Tracer
+	span     *Span
+	sent     int64
+	received int64
+	once     sync.Once
+}
+
+func (s *tracedStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+
+	if err == nil {
+		atomic.AddInt64(&s.sent, 1)
+	}
+
+	return err
+}
+
+func (s *tracedStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+
+	if err == nil {
+		atomic.AddInt64(&s.received, 1)
+		return nil
+	}
+
+	s.once.Do(func() {
+		spanErr := err
+
+		if spanErr == io.EOF {
+			spanErr = nil
+		}
+
+		s.span.SetAttribute("sent", int(atomic.LoadInt64(&s.sent)))
+		s.span.SetAttribute("received", int(atomic.LoadInt64(&s.received)))
+		s.span.SetAttribute("status", status.Code(spanErr).String())
+		s.tracer.Finish(s.span, spanErr)
+	})
+
+	return err
+}
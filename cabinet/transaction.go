@@ -9,7 +9,9 @@ package cabinet
 import (
 	pb "cds.ikigai.net/cabinet.v1/rpc"
 	"context"
+	"errors"
 	"fmt"
+	"google.golang.org/grpc/status"
 	"io"
 	"sync"
 )
@@ -19,20 +21,18 @@ const (
 	TRANSACTION_ERROR_CLOSING  = 1
 	TRANSACTION_ERROR_SENDING  = 2
 	TRANSACTION_ERROR_RESPONSE = 3
-
-	TRANSACTION_ERROR_OPERATION = 10
-	TRANSACTION_ERROR_EMPTY     = 11
+	TRANSACTION_ERROR_CANCELED = 4
+
+	TRANSACTION_ERROR_OPERATION  = 10
+	TRANSACTION_ERROR_EMPTY      = 11
+	TRANSACTION_ERROR_TMP_ID     = 12
+	TRANSACTION_ERROR_VALIDATION = 13
+	TRANSACTION_ERROR_STATE      = 14
+	TRANSACTION_ERROR_ORDER      = 15
+	TRANSACTION_ERROR_UNDO       = 16
+	TRANSACTION_ERROR_VETO       = 17
 )
 
-type TransactionError struct {
-	msg   string
-	class int
-}
-
-func (e *TransactionError) Error() string {
-	return fmt.Sprintf("ERR(%d): %s", e.class, e.msg)
-}
-
 type Transaction struct {
 	actions   map[uint32]*pb.TransactionAction
 	response  map[uint32]*pb.TransactionActionResponse
@@ -46,14 +46,40 @@ type Transaction struct {
 	tmpMap map[uint32]string
 	mapMux sync.Mutex
 
-	resError    error
-	resErrorMux sync.Mutex
+	retry    *RetryPolicy
+	attempts int
+
+	state    TransactionState
+	stateMux sync.Mutex
+
+	chunking  *ChunkPolicy
+	chunks    []*ChunkResult
+	committed map[uint32]bool
+
+	dryRun io.Writer
+
+	undoEnabled bool
+	undoLog     []*undoEntry
+	undoIndex   map[string]*undoEntry
+	undoSeen    map[uint32]bool
+
+	optimize  bool
+	optimized *OptimizeReport
+
+	hooks []*Hooks
 
 	client pb.CDSCabinetClient
 	ctx    context.Context
 }
 
 func (c *Transaction) Setup(ctx context.Context, cli pb.CDSCabinetClient) {
+	c.init()
+
+	c.client = cli
+	c.ctx = ctx
+}
+
+func (c *Transaction) init() {
 	c.actions = make(map[uint32]*pb.TransactionAction)
 	c.response = make(map[uint32]*pb.TransactionActionResponse)
 	c.queueErr = make([]error, 0)
@@ -62,28 +88,49 @@ func (c *Transaction) Setup(ctx context.Context, cli pb.CDSCabinetClient) {
 	c.idMap = make(map[string]string)
 	c.tmpMap = make(map[uint32]string)
 	c.actPos = uint32(1)
-
-	c.client = cli
-	c.ctx = ctx
-
-	c.resError = nil
+	c.committed = make(map[uint32]bool)
+	c.chunks = nil
+	c.attempts = 0
+	c.undoLog = nil
+	c.undoIndex = nil
+	c.undoSeen = nil
+	c.optimized = nil
+
+	c.setState(STATE_BUILDING)
 }
 
 func (c *Transaction) Operation(o pb.TransactionAction) {
-	if _, inActions := c.actions[o.ActionId]; inActions {
-		c.queueErr = append(c.queueErr, &TransactionError{msg: "duplicate actionID", class: TRANSACTION_ERROR_OPERATION})
+	if state := c.State(); state != STATE_BUILDING && state != STATE_FAILED {
+		c.queueErr = append(c.queueErr, &TransactionError{
+			msg:      fmt.Sprintf("action %d: cannot add actions to a %s transaction", o.ActionId, state),
+			class:    TRANSACTION_ERROR_STATE,
+			actionId: o.ActionId,
+		})
+		return
+	} else if _, inActions := c.actions[o.ActionId]; inActions {
+		c.queueErr = append(c.queueErr, &TransactionError{
+			msg:      fmt.Sprintf("action %d: duplicate actionID", o.ActionId),
+			class:    TRANSACTION_ERROR_OPERATION,
+			actionId: o.ActionId,
+		})
 		return
 	}
 
 	c.actions[o.ActionId] = &o
 	c.actionIDs = append(c.actionIDs, o.ActionId)
+
+	if tmpID := createdTmpID(&o); tmpID != "" {
+		c.tmpMap[o.ActionId] = tmpID
+	}
 }
 
-func (c *Transaction) O(o *pb.TransactionAction) {
+func (c *Transaction) O(o *pb.TransactionAction) *ActionHandle {
 	o.ActionId = c.actPos
 	c.actPos += 1
 
 	c.Operation(*o)
+
+	return &ActionHandle{trx: c, id: o.ActionId}
 }
 
 func (c *Transaction) Pos() uint32 {
@@ -95,74 +142,181 @@ func (c *Transaction) GetIdMap() map[string]string {
 }
 
 func (c *Transaction) Commit() error {
+	return c.CommitContext(c.ctx)
+}
+
+// CommitContext commits using ctx instead of the context given to Setup(); cancelling it aborts the stream
+func (c *Transaction) CommitContext(ctx context.Context) error {
+	return c.aroundCommit(c.commit)(ctx)
+}
+
+func (c *Transaction) commit(ctx context.Context) error {
 	if len(c.actions) == 0 {
 		return &TransactionError{msg: "no queued transactions", class: TRANSACTION_ERROR_EMPTY}
-	} else if len(c.queueErr) > 0 {
-		for er := range c.queueErr {
-			return c.queueErr[er]
-		}
+	} else if err := c.Validate(); err != nil {
+		return err
+	} else if c.dryRun != nil {
+		return c.dryRunCommit()
+	} else if err := c.beginCommit(); err != nil {
+		return err
+	}
+
+	if c.optimize && len(c.committed) == 0 {
+		c.optimized = c.rewrite()
+	}
+
+	c.attempts = 0
+	c.chunks = nil
+
+	order, err := c.Order()
+
+	if err == nil && c.undoEnabled {
+		err = c.captureUndo(ctx, order)
+	}
+
+	if err == nil && c.chunking != nil {
+		err = c.commitChunks(ctx, order)
+	} else if err == nil {
+		err = c.commitWithRetry(ctx, order)
+	}
+
+	if err != nil {
+		c.setState(STATE_FAILED)
+	} else {
+		c.setState(STATE_COMMITTED)
+	}
+
+	return err
+}
+
+// commitOnce runs a single transaction stream. The receiver is always drained before returning.
+func (c *Transaction) commitOnce(ctx context.Context, ids []uint32) error {
+	batch, err := c.prepare(ctx, ids)
+
+	if err != nil {
+		return err
 	}
 
-	stream, err := c.client.Transaction(c.ctx)
+	sCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client.Transaction(sCtx)
 
 	if err != nil {
-		return &TransactionError{msg: fmt.Sprintf("connection error: %s", err), class: TRANSACTION_ERROR_CONN}
+		return transactionFailure(TRANSACTION_ERROR_CONN, "connection error: ", err)
 	}
 
-	wc := make(chan struct{})
+	rc := make(chan error, 1)
 
 	go func() {
-		for {
-			actionResponse, err := stream.Recv()
-			// fmt.Printf("T.(receive) = %v, %v\n", actionResponse, err)
-
-			if err == io.EOF {
-				close(wc)
-				return
-			} else if err != nil {
-				c.resErrorMux.Lock()
-				c.resError = &TransactionError{msg: fmt.Sprintf("%s", err), class: TRANSACTION_ERROR_RESPONSE}
-				c.resErrorMux.Unlock()
-
-				close(wc)
-				return
-			} else {
-				c.resMux.Lock()
-				c.response[actionResponse.ActionId] = actionResponse
-				c.resMux.Unlock()
-
-				switch tReq := actionResponse.Response.(type) {
-				case *pb.TransactionActionResponse_NodeCreate:
-					c.mapMux.Lock()
-					c.idMap[c.tmpMap[actionResponse.ActionId]] = tReq.NodeCreate.Id
-					c.mapMux.Unlock()
-				}
-			}
-		}
+		rc <- c.receive(ctx, stream)
 	}()
 
-	for _, aID := range c.actionIDs {
-		// fmt.Printf("T.(send) %v\n", c.actions[aID])
+	sendErr := c.send(stream, batch)
+
+	if sendErr != nil {
+		cancel()
+	}
+
+	var recvErr error
 
-		if err := stream.Send(c.actions[aID]); err != nil {
-			return &TransactionError{msg: fmt.Sprintf("sending error: %s", err), class: TRANSACTION_ERROR_SENDING}
+	select {
+	case recvErr = <-rc:
+	case <-ctx.Done():
+		cancel()
+		<-rc
+
+		recvErr = canceledError(ctx.Err())
+	}
+
+	if trxErr, isTrx := recvErr.(*TransactionError); isTrx {
+		trxErr.actionId = c.firstPending(ids)
+	}
+
+	switch {
+	case sendErr == nil && recvErr == nil:
+		for _, aID := range ids {
+			c.committed[aID] = true
 		}
 
-		switch tReq := c.actions[aID].Action.(type) {
-		case *pb.TransactionAction_NodeCreate:
+		c.resolveTmpIDs()
+		return nil
+	case sendErr == nil:
+		return recvErr
+	case recvErr == nil || errors.Is(recvErr, ErrCanceled) && ctx.Err() == nil:
+		// the receiver only stopped because the failed send cancelled the stream
+		return sendErr
+	default:
+		return errors.Join(recvErr, sendErr)
+	}
+}
+
+func (c *Transaction) send(stream pb.CDSCabinet_TransactionClient, batch []*pb.TransactionAction) error {
+	for _, o := range batch {
+		// fmt.Printf("T.(send) %v\n", o)
+
+		if err := stream.Send(o); err != nil {
+			trxErr := transactionFailure(TRANSACTION_ERROR_SENDING, "sending error: ", err)
+			trxErr.actionId = o.ActionId
+
+			return trxErr
+		}
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return transactionFailure(TRANSACTION_ERROR_CLOSING, "close conn error: ", err)
+	}
+
+	return nil
+}
+
+func (c *Transaction) receive(ctx context.Context, stream pb.CDSCabinet_TransactionClient) error {
+	for {
+		actionResponse, err := stream.Recv()
+		// fmt.Printf("T.(receive) = %v, %v\n", actionResponse, err)
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return transactionFailure(TRANSACTION_ERROR_RESPONSE, "", err)
+		}
+
+		c.resMux.Lock()
+		c.response[actionResponse.ActionId] = actionResponse
+		c.resMux.Unlock()
+
+		switch tReq := actionResponse.Response.(type) {
+		case *pb.TransactionActionResponse_NodeCreate:
 			c.mapMux.Lock()
-			c.tmpMap[c.actions[aID].ActionId] = tReq.NodeCreate.Id
+			if tmpID, isTmp := c.tmpMap[actionResponse.ActionId]; isTmp {
+				c.idMap[tmpID] = tReq.NodeCreate.Id
+			}
 			c.mapMux.Unlock()
 		}
-	}
 
-	err = stream.CloseSend()
+		c.afterResponse(ctx, actionResponse)
+	}
+}
 
-	if err != nil {
-		return &TransactionError{msg: fmt.Sprintf("close conn error: %s", err), class: TRANSACTION_ERROR_CLOSING}
+func canceledError(err error) *TransactionError {
+	return &TransactionError{
+		msg:    fmt.Sprintf("commit interrupted: %s", err),
+		class:  TRANSACTION_ERROR_CANCELED,
+		status: status.FromContextError(err).Code(),
+		err:    err,
 	}
+}
+
+// firstPending is the first sent action without a response
+func (c *Transaction) firstPending(ids []uint32) uint32 {
+	c.resMux.Lock()
+	defer c.resMux.Unlock()
 
-	<-wc
+	for _, aID := range ids {
+		if _, received := c.response[aID]; !received {
+			return aID
+		}
+	}
 
-	return c.resError
+	return 0
 }
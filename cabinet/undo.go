@@ -0,0 +1,310 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+)
+
+// undoEntry is one object written by the transaction: its state before the commit and the last action on it
+type undoEntry struct {
+	iri     string
+	pre     proto.Message // nil when the object did not exist
+	last    uint32
+	counter int64 // sum of the counter increments
+}
+
+// SetUndo makes Commit() read the current state of every written object first, so an inverse transaction
+// can be built with Undo() once the commit succeeds. EdgeClear, MetaClear and the NodeDelete of an existing node
+// cannot be undone: the server gives a re-created node a new ID.
+func (c *Transaction) SetUndo(enabled bool) {
+	c.undoEnabled = enabled
+}
+
+// Undo is the compensating transaction of the last successful commit. Each restored object is guarded by a
+// ReadCheck EQUAL on the value this transaction wrote, so the undo fails if anything changed it since.
+// Objects deleted by the transaction, and counters, cannot be guarded.
+func (c *Transaction) Undo() (*Transaction, error) {
+	if !c.undoEnabled {
+		return nil, &TransactionError{msg: "undo is not enabled; call SetUndo(true) before Commit()", class: TRANSACTION_ERROR_UNDO}
+	} else if state := c.State(); state != STATE_COMMITTED {
+		return nil, &TransactionError{msg: fmt.Sprintf("cannot undo a %s transaction", state), class: TRANSACTION_ERROR_UNDO}
+	}
+
+	return c.buildUndo(), nil
+}
+
+// captureUndo reads the pre-image of every object the actions write. On a resumed chunked commit the objects
+// captured by the first attempt keep their original pre-image.
+func (c *Transaction) captureUndo(ctx context.Context, order []uint32) error {
+	if len(c.committed) == 0 {
+		c.undoLog = make([]*undoEntry, 0)
+		c.undoIndex = make(map[string]*undoEntry)
+		c.undoSeen = make(map[uint32]bool)
+	}
+
+	for _, aID := range order {
+		if c.undoSeen[aID] {
+			continue
+		}
+
+		c.undoSeen[aID] = true
+		o := c.actions[aID]
+		kind := KindOf(o)
+
+		switch kind {
+		case ACTION_READ_CHECK:
+			continue
+		case ACTION_EDGE_CLEAR, ACTION_META_CLEAR:
+			return &TransactionError{msg: fmt.Sprintf("action %d: %s cannot be undone", aID, kind), class: TRANSACTION_ERROR_UNDO, actionId: aID}
+		case ACTION_NODE_DELETE:
+			if !IsTmpID(o.GetNodeDelete().Id) {
+				return &TransactionError{msg: fmt.Sprintf("action %d: %s of an existing node cannot be undone", aID, kind), class: TRANSACTION_ERROR_UNDO, actionId: aID}
+			}
+		}
+
+		iri, _ := describeAction(o)
+
+		if entry, captured := c.undoIndex[iri]; captured {
+			entry.last = aID
+
+			if kind == ACTION_COUNTER_INCREMENT {
+				entry.counter += o.GetCounterIncrement().Value
+			}
+
+			continue
+		}
+
+		entry := &undoEntry{iri: iri, last: aID}
+
+		if kind == ACTION_COUNTER_INCREMENT {
+			entry.counter = o.GetCounterIncrement().Value
+		}
+
+		pre, err := c.preImage(ctx, o)
+
+		if err != nil {
+			trxErr := transactionFailure(TRANSACTION_ERROR_UNDO, fmt.Sprintf("action %d: reading pre-image of %s: ", aID, iri), err)
+			trxErr.actionId = aID
+
+			return trxErr
+		}
+
+		entry.pre = pre
+		c.undoIndex[iri] = entry
+		c.undoLog = append(c.undoLog, entry)
+	}
+
+	return nil
+}
+
+// preImage fetches the object an action writes, nil when it does not exist yet
+func (c *Transaction) preImage(ctx context.Context, o *pb.TransactionAction) (proto.Message, error) {
+	if KindOf(o) == ACTION_NODE_CREATE {
+		return nil, nil
+	}
+
+	for _, ref := range nodeRefs(o) {
+		if IsTmpID(*ref) {
+			return nil, nil
+		}
+	}
+
+	var pre proto.Message
+	var err error
+
+	switch tReq := o.Action.(type) {
+	case *pb.TransactionAction_NodeUpdate:
+		pre, err = c.client.NodeGet(ctx, &pb.NodeGetRequest{NodeType: tReq.NodeUpdate.Type, Id: tReq.NodeUpdate.Id})
+	case *pb.TransactionAction_NodeDelete:
+		pre, err = c.client.NodeGet(ctx, &pb.NodeGetRequest{NodeType: tReq.NodeDelete.Type, Id: tReq.NodeDelete.Id})
+	case *pb.TransactionAction_EdgeUpdate:
+		pre, err = c.client.EdgeGet(ctx, &pb.EdgeGetRequest{Edge: withoutEdgeProperties(tReq.EdgeUpdate)})
+	case *pb.TransactionAction_EdgeDelete:
+		pre, err = c.client.EdgeGet(ctx, &pb.EdgeGetRequest{Edge: withoutEdgeProperties(tReq.EdgeDelete)})
+	case *pb.TransactionAction_IndexCreate:
+		pre, err = c.client.IndexGet(ctx, &pb.IndexGetRequest{Index: withoutIndexProperties(tReq.IndexCreate)})
+	case *pb.TransactionAction_IndexDelete:
+		pre, err = c.client.IndexGet(ctx, &pb.IndexGetRequest{Index: withoutIndexProperties(tReq.IndexDelete)})
+	case *pb.TransactionAction_MetaUpdate:
+		pre, err = c.client.MetaGet(ctx, &pb.Meta{Object: tReq.MetaUpdate.Object, Key: tReq.MetaUpdate.Key})
+	case *pb.TransactionAction_MetaDelete:
+		pre, err = c.client.MetaGet(ctx, &pb.Meta{Object: tReq.MetaDelete.Object, Key: tReq.MetaDelete.Key})
+	case *pb.TransactionAction_CounterRegister:
+		pre, err = c.client.CounterGet(ctx, &pb.Counter{Object: tReq.CounterRegister.Object, Counter: tReq.CounterRegister.Counter})
+	case *pb.TransactionAction_CounterIncrement:
+		pre, err = c.client.CounterGet(ctx, &pb.Counter{Object: tReq.CounterIncrement.Object, Counter: tReq.CounterIncrement.Counter})
+	case *pb.TransactionAction_CounterDelete:
+		pre, err = c.client.CounterGet(ctx, &pb.Counter{Object: tReq.CounterDelete.Object, Counter: tReq.CounterDelete.Counter})
+	}
+
+	if errors.Is(Decode(err), ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return pre, nil
+}
+
+func withoutEdgeProperties(e *pb.Edge) *pb.Edge {
+	return &pb.Edge{Subject: e.Subject, Predicate: e.Predicate, Target: e.Target}
+}
+
+func withoutIndexProperties(i *pb.Index) *pb.Index {
+	return &pb.Index{Type: i.Type, Value: i.Value, Node: i.Node}
+}
+
+// guarded objects have an IRI a ReadCheck can compare against
+func guarded(kind ActionKind) bool {
+	switch kind {
+	case ACTION_NODE_CREATE, ACTION_NODE_UPDATE, ACTION_EDGE_UPDATE, ACTION_INDEX_CREATE, ACTION_META_UPDATE:
+		return true
+	default:
+		return false
+	}
+}
+
+func isDelete(kind ActionKind) bool {
+	switch kind {
+	case ACTION_NODE_DELETE, ACTION_EDGE_DELETE, ACTION_INDEX_DELETE, ACTION_META_DELETE, ACTION_COUNTER_DELETE:
+		return true
+	default:
+		return false
+	}
+}
+
+// buildUndo restores every captured object, newest first. The last action on each object has been rewritten
+// with real IDs by the commit, so it names the object as it exists now.
+func (c *Transaction) buildUndo() *Transaction {
+	u := &Transaction{}
+	u.Setup(c.ctx, c.client)
+	u.retry = c.retry
+	u.hooks = append(u.hooks, c.hooks...)
+
+	for e := len(c.undoLog) - 1; e >= 0; e-- {
+		entry := c.undoLog[e]
+		last := proto.Clone(c.actions[entry.last]).(*pb.TransactionAction)
+		kind := KindOf(last)
+
+		if guarded(kind) {
+			iri, _ := describeAction(last)
+			u.guardEqual(iri, writtenValue(last))
+		}
+
+		switch {
+		case entry.pre == nil && !isDelete(kind):
+			u.O(inverseOf(last))
+		case entry.pre != nil:
+			u.restore(entry, last)
+		}
+	}
+
+	return u
+}
+
+// writtenValue is the payload an action left on its object
+func writtenValue(o *pb.TransactionAction) []byte {
+	switch tReq := o.Action.(type) {
+	case *pb.TransactionAction_NodeCreate:
+		return tReq.NodeCreate.Properties
+	case *pb.TransactionAction_NodeUpdate:
+		return tReq.NodeUpdate.Properties
+	case *pb.TransactionAction_EdgeUpdate:
+		return tReq.EdgeUpdate.Properties
+	case *pb.TransactionAction_IndexCreate:
+		return tReq.IndexCreate.Properties
+	case *pb.TransactionAction_MetaUpdate:
+		return tReq.MetaUpdate.Val
+	default:
+		return nil
+	}
+}
+
+// inverseOf deletes an object the transaction created
+func inverseOf(o *pb.TransactionAction) *pb.TransactionAction {
+	switch tReq := o.Action.(type) {
+	case *pb.TransactionAction_NodeCreate:
+		return &pb.TransactionAction{Action: &pb.TransactionAction_NodeDelete{NodeDelete: tReq.NodeCreate}}
+	case *pb.TransactionAction_NodeUpdate:
+		return &pb.TransactionAction{Action: &pb.TransactionAction_NodeDelete{NodeDelete: tReq.NodeUpdate}}
+	case *pb.TransactionAction_EdgeUpdate:
+		return &pb.TransactionAction{Action: &pb.TransactionAction_EdgeDelete{EdgeDelete: tReq.EdgeUpdate}}
+	case *pb.TransactionAction_IndexCreate:
+		return &pb.TransactionAction{Action: &pb.TransactionAction_IndexDelete{IndexDelete: tReq.IndexCreate}}
+	case *pb.TransactionAction_MetaUpdate:
+		return &pb.TransactionAction{Action: &pb.TransactionAction_MetaDelete{MetaDelete: tReq.MetaUpdate}}
+	case *pb.TransactionAction_CounterRegister:
+		return &pb.TransactionAction{Action: &pb.TransactionAction_CounterDelete{CounterDelete: tReq.CounterRegister}}
+	case *pb.TransactionAction_CounterIncrement:
+		return &pb.TransactionAction{Action: &pb.TransactionAction_CounterDelete{CounterDelete: tReq.CounterIncrement}}
+	default:
+		return nil
+	}
+}
+
+// actionObject is the node, edge, index, meta or counter an action names
+func actionObject(o *pb.TransactionAction) proto.Message {
+	switch tReq := o.Action.(type) {
+	case *pb.TransactionAction_NodeCreate:
+		return tReq.NodeCreate
+	case *pb.TransactionAction_NodeUpdate:
+		return tReq.NodeUpdate
+	case *pb.TransactionAction_NodeDelete:
+		return tReq.NodeDelete
+	case *pb.TransactionAction_EdgeUpdate:
+		return tReq.EdgeUpdate
+	case *pb.TransactionAction_EdgeDelete:
+		return tReq.EdgeDelete
+	case *pb.TransactionAction_IndexCreate:
+		return tReq.IndexCreate
+	case *pb.TransactionAction_IndexDelete:
+		return tReq.IndexDelete
+	case *pb.TransactionAction_MetaUpdate:
+		return tReq.MetaUpdate
+	case *pb.TransactionAction_MetaDelete:
+		return tReq.MetaDelete
+	case *pb.TransactionAction_CounterRegister:
+		return tReq.CounterRegister
+	case *pb.TransactionAction_CounterIncrement:
+		return tReq.CounterIncrement
+	case *pb.TransactionAction_CounterDelete:
+		return tReq.CounterDelete
+	default:
+		return nil
+	}
+}
+
+// restore writes a pre-image back, re-creating it when the transaction deleted it. Get responses may carry
+// the payload alone, so the keys come from the last action on the object.
+func (u *Transaction) restore(entry *undoEntry, last *pb.TransactionAction) {
+	kind := KindOf(last)
+
+	switch key := actionObject(last).(type) {
+	case *pb.Node:
+		u.NodeUpdate(&pb.Node{Type: key.Type, Id: key.Id, Properties: payload(entry.pre)})
+	case *pb.Edge:
+		u.EdgeUpdate(&pb.Edge{Subject: key.Subject, Predicate: key.Predicate, Target: key.Target, Properties: payload(entry.pre)})
+	case *pb.Index:
+		u.IndexCreate(&pb.Index{Type: key.Type, Value: key.Value, Node: key.Node, Properties: payload(entry.pre)})
+	case *pb.Meta:
+		u.MetaUpdate(&pb.Meta{Object: key.Object, Key: key.Key, Val: payload(entry.pre)})
+	case *pb.Counter:
+		pre, _ := entry.pre.(*pb.Counter)
+
+		if kind == ACTION_COUNTER_DELETE && pre != nil {
+			u.CounterRegister(&pb.Counter{Object: key.Object, Counter: key.Counter})
+			u.CounterIncrement(&pb.Counter{Object: key.Object, Counter: key.Counter, Value: pre.Value})
+		} else if entry.counter != 0 {
+			u.CounterIncrement(&pb.Counter{Object: key.Object, Counter: key.Counter, Value: -entry.counter})
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package cabinet
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet/iri"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"fmt"
+	"github.com/segmentio/ksuid"
+	"sort"
+	"strings"
+)
+
+const WILDCARD = iri.WILDCARD
+
+// ValidationError reports every problem found in the queued actions at once
+type ValidationError struct {
+	Problems []*TransactionError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+
+	for p := range e.Problems {
+		msgs[p] = e.Problems[p].msg
+	}
+
+	return fmt.Sprintf("ERR(%d): %d invalid action(s): %s", TRANSACTION_ERROR_VALIDATION, len(e.Problems), strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Problems))
+
+	for p := range e.Problems {
+		errs[p] = e.Problems[p]
+	}
+
+	return errs
+}
+
+// ActionIDs lists the actions with at least one problem, in queue order
+func (e *ValidationError) ActionIDs() []uint32 {
+	seen := make(map[uint32]bool)
+	ids := make([]uint32, 0)
+
+	for _, p := range e.Problems {
+		if !seen[p.actionId] {
+			seen[p.actionId] = true
+			ids = append(ids, p.actionId)
+		}
+	}
+
+	return ids
+}
+
+type actionValidator struct {
+	aID      uint32
+	problems []*TransactionError
+}
+
+func (v *actionValidator) fail(format string, args ...interface{}) {
+	v.problems = append(v.problems, &TransactionError{
+		msg:      fmt.Sprintf("action %d: %s", v.aID, fmt.Sprintf(format, args...)),
+		class:    TRANSACTION_ERROR_VALIDATION,
+		actionId: v.aID,
+	})
+}
+
+// nodeID accepts KSUIDs, temporary IDs and, where allowed, the wildcard
+func (v *actionValidator) nodeID(field string, id string, wildcard bool) {
+	switch {
+	case id == "":
+		v.fail("missing %s", field)
+	case id == WILDCARD:
+		if !wildcard {
+			v.fail("wildcard %s is only allowed in EdgeClear", field)
+		}
+	case IsTmpID(id):
+		if len(id) == len(TMP_ID_PREFIX) {
+			v.fail("empty temporary %s", field)
+		}
+	default:
+		if _, err := ksuid.Parse(id); err != nil {
+			v.fail("malformed %s %q: %v", field, id, err)
+		}
+	}
+}
+
+func (v *actionValidator) node(n *pb.Node) {
+	if n == nil {
+		v.fail("missing node")
+		return
+	}
+
+	if n.Type == 0 {
+		v.fail("missing node type")
+	}
+
+	v.nodeID("node id", n.Id, false)
+}
+
+func (v *actionValidator) edge(e *pb.Edge, wildcard bool) {
+	if e == nil {
+		v.fail("missing edge")
+		return
+	}
+
+	v.nodeID("edge subject", e.Subject, false)
+	v.nodeID("edge target", e.Target, wildcard)
+
+	if e.Predicate == 0 {
+		v.fail("missing edge predicate")
+	}
+}
+
+func (v *actionValidator) index(i *pb.Index) {
+	if i == nil {
+		v.fail("missing index")
+		return
+	}
+
+	if i.Type == 0 {
+		v.fail("missing index type")
+	}
+
+	if i.Value == "" {
+		v.fail("missing index value")
+	} else if iri.AmbiguousValue(i.Value) {
+		v.fail("index value %q holds %%2F, which its IRI cannot tell from /", i.Value)
+	}
+
+	v.nodeID("index node", i.Node, false)
+}
+
+func (v *actionValidator) meta(m *pb.Meta, clear bool) {
+	if m == nil {
+		v.fail("missing meta")
+		return
+	}
+
+	switch mo := m.Object.(type) {
+	case *pb.Meta_Node:
+		v.nodeID("meta node", mo.Node, false)
+	case *pb.Meta_Edge:
+		v.edge(mo.Edge, false)
+	default:
+		v.fail("missing meta object")
+	}
+
+	if m.Key == 0 && !clear {
+		v.fail("missing meta key")
+	}
+}
+
+func (v *actionValidator) counter(s *pb.Counter) {
+	if s == nil {
+		v.fail("missing counter")
+		return
+	}
+
+	switch so := s.Object.(type) {
+	case *pb.Counter_Node:
+		v.nodeID("counter node", so.Node, false)
+	case *pb.Counter_Edge:
+		v.edge(so.Edge, false)
+	default:
+		v.fail("missing counter object")
+	}
+
+	if s.Counter == 0 {
+		v.fail("missing counter id")
+	}
+}
+
+func (v *actionValidator) readCheck(r *pb.ReadCheckRequest) {
+	if r == nil {
+		v.fail("missing read check")
+		return
+	}
+
+	if r.Source == "" {
+		v.fail("missing read check source")
+	}
+
+	if r.Target == nil || r.Target.Target == nil {
+		v.fail("missing read check target")
+	}
+}
+
+func (v *actionValidator) action(o *pb.TransactionAction) {
+	switch tReq := o.Action.(type) {
+	case *pb.TransactionAction_NodeCreate:
+		v.node(tReq.NodeCreate)
+	case *pb.TransactionAction_NodeUpdate:
+		v.node(tReq.NodeUpdate)
+	case *pb.TransactionAction_NodeDelete:
+		v.node(tReq.NodeDelete)
+	case *pb.TransactionAction_EdgeUpdate:
+		v.edge(tReq.EdgeUpdate, false)
+	case *pb.TransactionAction_EdgeDelete:
+		v.edge(tReq.EdgeDelete, false)
+	case *pb.TransactionAction_EdgeClear:
+		v.edge(tReq.EdgeClear, true)
+	case *pb.TransactionAction_IndexCreate:
+		v.index(tReq.IndexCreate)
+	case *pb.TransactionAction_IndexDelete:
+		v.index(tReq.IndexDelete)
+	case *pb.TransactionAction_MetaUpdate:
+		v.meta(tReq.MetaUpdate, false)
+	case *pb.TransactionAction_MetaDelete:
+		v.meta(tReq.MetaDelete, false)
+	case *pb.TransactionAction_MetaClear:
+		v.meta(tReq.MetaClear, true)
+	case *pb.TransactionAction_CounterRegister:
+		v.counter(tReq.CounterRegister)
+	case *pb.TransactionAction_CounterIncrement:
+		v.counter(tReq.CounterIncrement)
+	case *pb.TransactionAction_CounterDelete:
+		v.counter(tReq.CounterDelete)
+	case *pb.TransactionAction_ReadCheck:
+		v.readCheck(tReq.ReadCheck)
+	default:
+		v.fail("unknown action %T", o.Action)
+	}
+}
+
+// Validate checks the queued actions locally, without contacting the server
+func (c *Transaction) Validate() error {
+	problems := make([]*TransactionError, 0)
+
+	for _, qErr := range c.queueErr {
+		if trxErr, isTrx := qErr.(*TransactionError); isTrx {
+			problems = append(problems, trxErr)
+		} else {
+			problems = append(problems, &TransactionError{msg: qErr.Error(), class: TRANSACTION_ERROR_OPERATION})
+		}
+	}
+
+	for _, aID := range c.actionIDs {
+		v := actionValidator{aID: aID}
+		v.action(c.actions[aID])
+
+		problems = append(problems, v.problems...)
+	}
+
+	problems = append(problems, c.tmpRefProblems()...)
+
+	if order, orderErr := c.buildGraph().sort(c); orderErr != nil {
+		problems = append(problems, orderErr)
+	} else {
+		problems = append(problems, c.chunkProblems(order)...)
+	}
+
+	position := make(map[uint32]int)
+
+	for pos, aID := range c.actionIDs {
+		position[aID] = pos
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return position[problems[i].actionId] < position[problems[j].actionId]
+	})
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	"cds.ikigai.net/cabinet.v1.test/cabinet/iri"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestIRIBuildAndParse(t *testing.T) {
+	subject, target := MockRandomNodeID(), MockRandomNodeID()
+	edge := &pb.Edge{Subject: subject, Predicate: 7, Target: target}
+
+	cases := []struct {
+		built    iri.IRI
+		expected string
+		wildcard bool
+	}{
+		{iri.NodeOf(&pb.Node{Type: 3, Id: subject}), fmt.Sprintf("n/3/%s", subject), false},
+		{iri.EdgeOf(edge), fmt.Sprintf("e/%s/7/%s", subject, target), false},
+		{iri.EdgeOf(&pb.Edge{Subject: subject, Predicate: 7, Target: iri.WILDCARD}), fmt.Sprintf("e/%s/7/*", subject), true},
+		{iri.IndexOf(&pb.Index{Type: 2, Value: "a/b%c", Node: target}), fmt.Sprintf("i/2/a%%2Fb%%c/%s", target), false},
+		{iri.IndexOf(&pb.Index{Type: 2, Value: "100%25", Node: target}), fmt.Sprintf("i/2/100%%25/%s", target), false}, // as built before escaping
+		{iri.MetaOf(&pb.Meta{Object: &pb.Meta_Node{Node: subject}, Key: 9}), fmt.Sprintf("m/n/%s/9", subject), false},
+		{iri.MetaOf(&pb.Meta{Object: &pb.Meta_Node{Node: subject}}), fmt.Sprintf("m/n/%s/*", subject), true},
+		{iri.MetaOf(&pb.Meta{Object: &pb.Meta_Edge{Edge: edge}, Key: 4}), fmt.Sprintf("m/e/%s/7/%s/4", subject, target), false},
+		{iri.CounterOf(&pb.Counter{Object: &pb.Counter_Edge{Edge: edge}, Counter: 2}), fmt.Sprintf("c/e/%s/7/%s/2", subject, target), false},
+	}
+
+	for _, c := range cases {
+		if c.built.String() != c.expected || c.built.Wildcard() != c.wildcard {
+			t.Errorf("built %s (wildcard %v), expected %s (wildcard %v)", c.built, c.built.Wildcard(), c.expected, c.wildcard)
+			continue
+		}
+
+		parsed, err := iri.Parse(c.expected)
+
+		if err != nil {
+			t.Errorf("Parse(%s) = %v", c.expected, err)
+		} else if parsed != c.built {
+			t.Errorf("Parse(%s) = %#v, expected %#v", c.expected, parsed, c.built)
+		}
+	}
+}
+
+func TestIRIAmbiguousValue(t *testing.T) {
+	nodeID := MockRandomNodeID()
+
+	for _, value := range []string{"a/b", "100%25", "a%2Fb", "a%2fb"} {
+		parsed, err := iri.Parse(iri.IndexOf(&pb.Index{Type: 2, Value: value, Node: nodeID}).String())
+
+		if err != nil {
+			t.Errorf("Parse(%q) = %v", value, err)
+		} else if roundTrip := parsed.(iri.Index).Value == value; roundTrip == iri.AmbiguousValue(value) {
+			t.Errorf("value %q round trip %v, ambiguous %v", value, roundTrip, iri.AmbiguousValue(value))
+		}
+	}
+
+	trx := cabinet.Transaction{}
+	trx.Setup(context.Background(), nil)
+	trx.IndexCreate(&pb.Index{Type: 2, Value: "a%2Fb", Node: nodeID})
+
+	var validationErr *cabinet.ValidationError
+	if err := trx.Validate(); !errors.As(err, &validationErr) {
+		t.Errorf("expected an index value holding %%2F to be rejected, got %v", err)
+	}
+}
+
+func TestIRIParseRejects(t *testing.T) {
+	nodeID := MockRandomNodeID()
+
+	for _, s := range []string{
+		"",
+		"x/1/" + nodeID,
+		"n/1",
+		"n/0/" + nodeID,
+		"n/abc/" + nodeID,
+		"n/1/not-a-ksuid",
+		"n/1/*",
+		"n/1/" + nodeID + "/extra",
+		"i/1//" + nodeID,
+		"e/*/1/" + nodeID,
+		"m/e/" + nodeID + "/1/*/2",
+		"m/x/" + nodeID + "/2",
+		"c/n/" + nodeID + "/*",
+		"n/4294967296/" + nodeID,
+	} {
+		if parsed, err := iri.Parse(s); !errors.Is(err, iri.ErrMalformed) {
+			t.Errorf("Parse(%q) = %v, %v; expected it to be rejected", s, parsed, err)
+		}
+	}
+}
+
+func TestIRIGet(t *testing.T) {
+	node := &pb.Node{Type: 3, Id: MockRandomNodeID(), Properties: []byte("cats")}
+	edge := &pb.Edge{Subject: node.Id, Predicate: 5, Target: MockRandomNodeID(), Properties: []byte("dogs")}
+	mock := &MockCabinet{nodes: map[string]*pb.Node{node.Id: node}, edges: map[string]*pb.Edge{mockEdgeKey(edge): edge}}
+	ctx := context.Background()
+
+	if found, err := cabinet.Get(ctx, mock, iri.NodeOf(node).String()); err != nil || string(found.(*pb.Node).Properties) != "cats" {
+		t.Errorf("Get(node) = %v, %v", found, err)
+	}
+
+	if found, err := cabinet.Get(ctx, mock, iri.EdgeOf(edge).String()); err != nil || string(found.(*pb.Edge).Properties) != "dogs" {
+		t.Errorf("Get(edge) = %v, %v", found, err)
+	}
+
+	if found, err := cabinet.Get(ctx, mock, fmt.Sprintf("n/4/%s", node.Id)); found != nil || !errors.Is(cabinet.Decode(err), cabinet.ErrNotFound) {
+		t.Errorf("Get(missing node) = %v, %v", found, err)
+	}
+
+	if _, err := cabinet.Get(ctx, mock, fmt.Sprintf("e/%s/5/*", node.Id)); !errors.Is(err, cabinet.ErrWildcard) {
+		t.Errorf("Get(wildcard) = %v", err)
+	}
+
+	if _, err := cabinet.Get(ctx, mock, "n/3/tmp:1"); !errors.Is(err, iri.ErrMalformed) {
+		t.Errorf("Get(tmp ID) = %v", err)
+	}
+}
+
+func TestIRIDeleteAction(t *testing.T) {
+	subject, target := MockRandomNodeID(), MockRandomNodeID()
+
+	cases := []struct {
+		address string
+		kind    cabinet.ActionKind
+	}{
+		{fmt.Sprintf("n/3/%s", subject), cabinet.ACTION_NODE_DELETE},
+		{fmt.Sprintf("e/%s/5/%s", subject, target), cabinet.ACTION_EDGE_DELETE},
+		{fmt.Sprintf("e/%s/5/*", subject), cabinet.ACTION_EDGE_CLEAR},
+		{fmt.Sprintf("i/2/a%%2Fb/%s", target), cabinet.ACTION_INDEX_DELETE},
+		{fmt.Sprintf("m/n/%s/9", subject), cabinet.ACTION_META_DELETE},
+		{fmt.Sprintf("m/e/%s/5/%s/*", subject, target), cabinet.ACTION_META_CLEAR},
+		{fmt.Sprintf("c/n/%s/1", subject), cabinet.ACTION_COUNTER_DELETE},
+	}
+
+	trx := cabinet.Transaction{}
+	trx.Setup(context.Background(), &MockCabinet{})
+
+	for _, c := range cases {
+		o, err := cabinet.DeleteAction(c.address)
+
+		if err != nil || cabinet.KindOf(o) != c.kind {
+			t.Errorf("DeleteAction(%s) = %v, %v; expected %s", c.address, o, err, c.kind)
+			continue
+		}
+
+		trx.O(o)
+	}
+
+	if err := trx.Validate(); err != nil {
+		t.Errorf("delete actions do not validate: %v", err)
+	}
+
+	if o := trx.Results()[3].Action; o.GetIndexDelete().Value != "a/b" {
+		t.Errorf("index value was not unescaped: %v", o)
+	}
+}
@@ -0,0 +1,165 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"sync"
+)
+
+// MockCabinet answers transactions locally, for tests that exercise the client rather than cds.v1.
+// Every action is acknowledged with an empty response, unless createIDs asks for NodeCreates to get an ID,
+// and NodeUpdates are applied to the seeded nodes;
+// NodeGet and EdgeGet read the seeded objects; other RPCs are not implemented.
+type MockCabinet struct {
+	pb.CDSCabinetClient
+
+	failConnections int  // Transaction() calls to reject with Unavailable before accepting any
+	rejectStream    int  // the n-th Transaction() call is rejected with Internal
+	failReadChecks  int  // transactions with a ReadCheck to fail with E(0x013) before letting one through
+	createIDs       bool // NodeCreates are answered with a new node ID
+	payloadOnly     bool // NodeGet and EdgeGet answer with the payload alone, without the keys
+
+	nodes map[string]*pb.Node // by ID
+	edges map[string]*pb.Edge // by subject/predicate/target
+
+	mux     sync.Mutex
+	streams int
+	commits [][]*pb.TransactionAction
+}
+
+func (m *MockCabinet) Transaction(ctx context.Context, opts ...grpc.CallOption) (pb.CDSCabinet_TransactionClient, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.streams += 1
+
+	if m.streams <= m.failConnections {
+		return nil, status.Error(codes.Unavailable, "mock connection refused")
+	} else if m.streams == m.rejectStream {
+		return nil, status.Error(codes.Internal, "mock stream rejected")
+	}
+
+	return &mockTransactionStream{ctx: ctx, cabinet: m, responses: make(chan *pb.TransactionActionResponse, 1024)}, nil
+}
+
+func mockEdgeKey(e *pb.Edge) string {
+	return fmt.Sprintf("%s/%d/%s", e.Subject, e.Predicate, e.Target)
+}
+
+func (m *MockCabinet) NodeGet(ctx context.Context, in *pb.NodeGetRequest, opts ...grpc.CallOption) (*pb.Node, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if n, found := m.nodes[in.Id]; found && n.Type == in.NodeType && m.payloadOnly {
+		return &pb.Node{Properties: n.Properties}, nil
+	} else if found && n.Type == in.NodeType {
+		return &pb.Node{Type: n.Type, Id: n.Id, Version: n.Version, Properties: n.Properties}, nil
+	}
+
+	return nil, status.Error(codes.NotFound, "mock node not found")
+}
+
+func (m *MockCabinet) EdgeGet(ctx context.Context, in *pb.EdgeGetRequest, opts ...grpc.CallOption) (*pb.Edge, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if e, found := m.edges[mockEdgeKey(in.Edge)]; found && m.payloadOnly {
+		return &pb.Edge{Properties: e.Properties}, nil
+	} else if found {
+		return e, nil
+	}
+
+	return nil, status.Error(codes.NotFound, "mock edge not found")
+}
+
+func (m *MockCabinet) Streams() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return m.streams
+}
+
+func (m *MockCabinet) Commits() [][]*pb.TransactionAction {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return m.commits
+}
+
+type mockTransactionStream struct {
+	grpc.ClientStream
+
+	ctx       context.Context
+	cabinet   *MockCabinet
+	received  []*pb.TransactionAction
+	responses chan *pb.TransactionActionResponse
+	failure   error
+}
+
+func (s *mockTransactionStream) Send(o *pb.TransactionAction) error {
+	if err := s.ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+
+	s.received = append(s.received, o)
+	r := &pb.TransactionActionResponse{ActionId: o.ActionId}
+
+	if _, isCreate := o.Action.(*pb.TransactionAction_NodeCreate); isCreate && s.cabinet.createIDs {
+		r.Response = &pb.TransactionActionResponse_NodeCreate{NodeCreate: &pb.NodeCreateResponse{Id: MockRandomNodeID()}}
+	}
+
+	s.responses <- r
+
+	return nil
+}
+
+func (s *mockTransactionStream) CloseSend() error {
+	m := s.cabinet
+
+	m.mux.Lock()
+	m.commits = append(m.commits, s.received)
+
+	for _, o := range s.received {
+		if _, isCheck := o.Action.(*pb.TransactionAction_ReadCheck); isCheck && m.failReadChecks > 0 {
+			m.failReadChecks -= 1
+			s.failure = status.Error(codes.FailedPrecondition, "E(0x013) read check failed")
+			break
+		}
+	}
+
+	for _, o := range s.received {
+		if nu, isUpdate := o.Action.(*pb.TransactionAction_NodeUpdate); isUpdate && s.failure == nil && m.nodes[nu.NodeUpdate.Id] != nil {
+			m.nodes[nu.NodeUpdate.Id].Properties = nu.NodeUpdate.Properties
+		}
+	}
+	m.mux.Unlock()
+
+	close(s.responses)
+	return nil
+}
+
+func (s *mockTransactionStream) Recv() (*pb.TransactionActionResponse, error) {
+	select {
+	case <-s.ctx.Done():
+		return nil, status.FromContextError(s.ctx.Err()).Err()
+	case r, open := <-s.responses:
+		if !open && s.failure != nil {
+			return nil, s.failure
+		} else if !open {
+			return nil, io.EOF
+		}
+
+		return r, nil
+	}
+}
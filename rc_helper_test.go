@@ -8,8 +8,9 @@
 package main
 
 import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	"cds.ikigai.net/cabinet.v1.test/cabinet/iri"
 	pb "cds.ikigai.net/cabinet.v1/rpc"
-	"fmt"
 	"testing"
 )
 
@@ -98,7 +99,7 @@ func (r *ReadCheckValidator) newNode(payload []byte) *pb.Node {
 
 func (r *ReadCheckValidator) newNodeIRI(payload []byte) string {
 	n := r.newNode(payload)
-	return fmt.Sprintf("n/%d/%s", n.Type, n.Id)
+	return iri.NodeOf(n).String()
 }
 
 func (r *ReadCheckValidator) newIndex(payload []byte) *pb.Index {
@@ -114,7 +115,7 @@ func (r *ReadCheckValidator) newIndex(payload []byte) *pb.Index {
 
 func (r *ReadCheckValidator) newIndexIRI(payload []byte) string {
 	i := r.newIndex(payload)
-	return fmt.Sprintf("i/%d/%s/%s", i.Type, i.Value, i.Node)
+	return iri.IndexOf(i).String()
 }
 
 func (r *ReadCheckValidator) newEdge(payload []byte) *pb.Edge {
@@ -130,7 +131,7 @@ func (r *ReadCheckValidator) newEdge(payload []byte) *pb.Edge {
 
 func (r *ReadCheckValidator) newEdgeIRI(payload []byte) string {
 	e := r.newEdge(payload)
-	return fmt.Sprintf("e/%s/%d/%s", e.Subject, e.Predicate, e.Target)
+	return iri.EdgeOf(e).String()
 }
 
 func (r *ReadCheckValidator) newMetaEdge(payload []byte) (m *pb.Meta, e *pb.Edge) {
@@ -146,8 +147,8 @@ func (r *ReadCheckValidator) newMetaEdge(payload []byte) (m *pb.Meta, e *pb.Edge
 }
 
 func (r *ReadCheckValidator) newMetaEdgeIRI(payload []byte) string {
-	m, e := r.newMetaEdge(payload)
-	return fmt.Sprintf("m/e/%s/%d/%s/%d", e.Subject, e.Predicate, e.Target, m.Key)
+	m, _ := r.newMetaEdge(payload)
+	return iri.MetaOf(m).String()
 }
 
 func (r *ReadCheckValidator) newMetaNode(payload []byte) (m *pb.Meta, n *pb.Node) {
@@ -163,63 +164,53 @@ func (r *ReadCheckValidator) newMetaNode(payload []byte) (m *pb.Meta, n *pb.Node
 }
 
 func (r *ReadCheckValidator) newMetaNodeIRI(payload []byte) string {
-	m, n := r.newMetaNode(payload)
-	return fmt.Sprintf("m/n/%s/%d", n.Id, m.Key)
+	m, _ := r.newMetaNode(payload)
+	return iri.MetaOf(m).String()
 }
 
 func (r *ReadCheckValidator) touchExists() {
 	// positive test
-	r.check(&pb.ReadCheckRequest{
-		Source: r.sourceIRI, Operator: pb.CheckOperators_EXISTS, Target: &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: "*"}},
-	}, true)
-
-	r.check(&pb.ReadCheckRequest{
-		Source: r.sourceIRI, Operator: pb.CheckOperators_TOUCH, Target: &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: "*"}},
-	}, true)
+	r.checkCondition(cabinet.Check(r.sourceIRI).Exists(), true)
+	r.checkCondition(cabinet.Check(r.sourceIRI).Touch(), true)
 }
 
 func (r *ReadCheckValidator) eqString() {
-	equalT := &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: string(r.p1)}}
-	neT := &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: string(r.p2)}}
-	r.eqSpecific(equalT, neT)
+	source := cabinet.Check(r.sourceIRI)
+	r.eqSpecific(source.Equals, source.NotEquals, string(r.p1), string(r.p2))
 }
 
 func (r *ReadCheckValidator) eqNode() {
-	equalT := &pb.CheckTarget{Target: &pb.CheckTarget_Iri{Iri: r.newNodeIRI(r.p1)}}
-	neT := &pb.CheckTarget{Target: &pb.CheckTarget_Iri{Iri: r.newNodeIRI(r.p2)}}
-	r.eqSpecific(equalT, neT)
+	r.eqObjects(r.newNodeIRI(r.p1), r.newNodeIRI(r.p2))
 }
 
 func (r *ReadCheckValidator) eqIndex() {
-	equalT := &pb.CheckTarget{Target: &pb.CheckTarget_Iri{Iri: r.newIndexIRI(r.p1)}}
-	neT := &pb.CheckTarget{Target: &pb.CheckTarget_Iri{Iri: r.newIndexIRI(r.p2)}}
-	r.eqSpecific(equalT, neT)
+	r.eqObjects(r.newIndexIRI(r.p1), r.newIndexIRI(r.p2))
 }
 
 func (r *ReadCheckValidator) eqEdge() {
-	equalT := &pb.CheckTarget{Target: &pb.CheckTarget_Iri{Iri: r.newEdgeIRI(r.p1)}}
-	neT := &pb.CheckTarget{Target: &pb.CheckTarget_Iri{Iri: r.newEdgeIRI(r.p2)}}
-	r.eqSpecific(equalT, neT)
+	r.eqObjects(r.newEdgeIRI(r.p1), r.newEdgeIRI(r.p2))
 }
 
 func (r *ReadCheckValidator) eqMetaEdge() {
-	equalT := &pb.CheckTarget{Target: &pb.CheckTarget_Iri{Iri: r.newMetaEdgeIRI(r.p1)}}
-	neT := &pb.CheckTarget{Target: &pb.CheckTarget_Iri{Iri: r.newMetaEdgeIRI(r.p2)}}
-	r.eqSpecific(equalT, neT)
+	r.eqObjects(r.newMetaEdgeIRI(r.p1), r.newMetaEdgeIRI(r.p2))
 }
 
 func (r *ReadCheckValidator) eqMetaNode() {
-	equalT := &pb.CheckTarget{Target: &pb.CheckTarget_Iri{Iri: r.newMetaNodeIRI(r.p1)}}
-	neT := &pb.CheckTarget{Target: &pb.CheckTarget_Iri{Iri: r.newMetaNodeIRI(r.p2)}}
-	r.eqSpecific(equalT, neT)
+	r.eqObjects(r.newMetaNodeIRI(r.p1), r.newMetaNodeIRI(r.p2))
+}
+
+func (r *ReadCheckValidator) eqObjects(equal string, different string) {
+	source := cabinet.Check(r.sourceIRI)
+	r.eqSpecific(source.EqualsObject, source.NotEqualsObject, equal, different)
 }
 
-func (r *ReadCheckValidator) eqSpecific(eT *pb.CheckTarget, neT *pb.CheckTarget) {
-	r.check(&pb.ReadCheckRequest{Source: r.sourceIRI, Operator: pb.CheckOperators_EQUAL, Target: eT}, true)
-	r.check(&pb.ReadCheckRequest{Source: r.sourceIRI, Operator: pb.CheckOperators_NOT_EQUAL, Target: neT}, true)
+// eqSpecific checks the source against a target with the same payload and one with a different payload
+func (r *ReadCheckValidator) eqSpecific(eq, ne func(target string) *cabinet.Condition, equal string, different string) {
+	r.checkCondition(eq(equal), true)
+	r.checkCondition(ne(different), true)
 
-	r.check(&pb.ReadCheckRequest{Source: r.sourceIRI, Operator: pb.CheckOperators_EQUAL, Target: neT}, false)
-	r.check(&pb.ReadCheckRequest{Source: r.sourceIRI, Operator: pb.CheckOperators_NOT_EQUAL, Target: eT}, false)
+	r.checkCondition(eq(different), false)
+	r.checkCondition(ne(equal), false)
 }
 
 func (r *ReadCheckValidator) check(rq *pb.ReadCheckRequest, expected bool) {
@@ -233,6 +224,17 @@ func (r *ReadCheckValidator) check(rq *pb.ReadCheckRequest, expected bool) {
 	}
 }
 
+func (r *ReadCheckValidator) checkCondition(cond *cabinet.Condition, expected bool) {
+	rq, err := cond.Request()
+
+	if err != nil {
+		r.it.test.Errorf("[E] invalid read check: %v", err)
+		return
+	}
+
+	r.check(rq, expected)
+}
+
 func (r *ReadCheckValidator) cleanUp() {
 	trx := make([]pb.TransactionAction, 0)
 	a := uint32(0)
@@ -0,0 +1,125 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	"cds.ikigai.net/cabinet.v1.test/cabinet/iri"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"testing"
+)
+
+// offlineObject builds an object of the given RC_ kind holding payload, with its IRI
+func offlineObject(kind int, payload []byte) (proto.Message, string) {
+	edge := &pb.Edge{Subject: MockRandomNodeID(), Predicate: uint32(MockRandomInt(10, 10000)), Target: MockRandomNodeID(), Properties: payload}
+
+	switch kind {
+	case RC_NODE:
+		n := &pb.Node{Type: uint32(MockRandomInt(10, 10000)), Id: MockRandomNodeID(), Properties: payload}
+		return n, iri.NodeOf(n).String()
+	case RC_EDGE:
+		return edge, iri.EdgeOf(edge).String()
+	case RC_INDEX:
+		i := &pb.Index{Type: uint32(MockRandomInt(10, 10000)), Node: MockRandomNodeID(), Value: "test/value", Properties: payload}
+		return i, iri.IndexOf(i).String()
+	case RC_META_NODE:
+		m := &pb.Meta{Object: &pb.Meta_Node{Node: MockRandomNodeID()}, Key: uint32(MockRandomInt(10, 10000)), Val: payload}
+		return m, iri.MetaOf(m).String()
+	case RC_META_EDGE:
+		m := &pb.Meta{Object: &pb.Meta_Edge{Edge: edge}, Key: uint32(MockRandomInt(10, 10000)), Val: payload}
+		return m, iri.MetaOf(m).String()
+	default:
+		panic("unknown R/C kind")
+	}
+}
+
+// TestReadCheckEvaluateMatrix runs the ReadCheckValidator matrix against EvaluateReadCheck
+func TestReadCheckEvaluateMatrix(t *testing.T) {
+	sources := []int{RC_NODE, RC_EDGE, RC_INDEX, RC_META_NODE, RC_META_EDGE}
+	targets := []int{RC_STRING, RC_NODE, RC_EDGE, RC_INDEX, RC_META_NODE, RC_META_EDGE}
+
+	for _, from := range sources {
+		for _, to := range targets {
+			p1, p2 := MockRandomPayload(), MockRandomPayload()
+			objects := cabinet.NewObjectSet()
+
+			source, sourceIRI := offlineObject(from, p1)
+			objects.Add(source)
+
+			var eT, neT *pb.CheckTarget
+
+			if to == RC_STRING {
+				eT = &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: string(p1)}}
+				neT = &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: string(p2)}}
+			} else {
+				equal, equalIRI := offlineObject(to, p1)
+				different, differentIRI := offlineObject(to, p2)
+				objects.Add(equal, different)
+
+				eT = &pb.CheckTarget{Target: &pb.CheckTarget_Iri{Iri: equalIRI}}
+				neT = &pb.CheckTarget{Target: &pb.CheckTarget_Iri{Iri: differentIRI}}
+			}
+
+			wildcard := &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: "*"}}
+
+			for _, c := range []struct {
+				operator pb.CheckOperators
+				target   *pb.CheckTarget
+				expected bool
+			}{
+				{pb.CheckOperators_EXISTS, wildcard, true},
+				{pb.CheckOperators_TOUCH, wildcard, true},
+				{pb.CheckOperators_EQUAL, eT, true},
+				{pb.CheckOperators_NOT_EQUAL, neT, true},
+				{pb.CheckOperators_EQUAL, neT, false},
+				{pb.CheckOperators_NOT_EQUAL, eT, false},
+			} {
+				rq := &pb.ReadCheckRequest{Source: sourceIRI, Operator: c.operator, Target: c.target}
+
+				if result, err := cabinet.EvaluateReadCheck(rq, objects); err != nil || result != c.expected {
+					t.Errorf("[%d -> %d] EvaluateReadCheck(%v) = %v, %v; expected %v", from, to, rq, result, err, c.expected)
+				}
+			}
+		}
+	}
+}
+
+func TestReadCheckEvaluateMissing(t *testing.T) {
+	node := &pb.Node{Type: 1, Id: MockRandomNodeID(), Properties: []byte("cats")}
+	meta := &pb.Meta{Object: &pb.Meta_Node{Node: node.Id}, Key: 4, Val: []byte("dogs")}
+	objects := cabinet.NewObjectSet(node, meta)
+
+	missing := fmt.Sprintf("n/1/%s", MockRandomNodeID())
+
+	for _, c := range []struct {
+		cond     *cabinet.Condition
+		expected bool
+	}{
+		{cabinet.Check(missing).Exists(), false},
+		{cabinet.Check(missing).NotEquals("cats"), false},
+		{cabinet.Check(iri.NodeOf(node).String()).NotEqualsObject(missing), false},
+		{cabinet.Check(fmt.Sprintf("m/n/%s/*", node.Id)).Exists(), true},
+		{cabinet.Check(fmt.Sprintf("m/n/%s/*", MockRandomNodeID())).Touch(), false},
+	} {
+		rq, _ := c.cond.Request()
+
+		if result, err := c.cond.Evaluate(objects); err != nil || result != c.expected {
+			t.Errorf("Evaluate(%v) = %v, %v; expected %v", rq, result, err, c.expected)
+		}
+	}
+
+	wildcardEqual := &pb.ReadCheckRequest{
+		Source: fmt.Sprintf("m/n/%s/*", node.Id), Operator: pb.CheckOperators_EQUAL, Target: &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: "dogs"}},
+	}
+
+	if _, err := cabinet.EvaluateReadCheck(wildcardEqual, objects); !errors.Is(err, cabinet.ErrWildcard) {
+		t.Errorf("EQUAL on a wildcard = %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTransactionCommitAsync(t *testing.T) {
+	mock := &MockCabinet{}
+	futures := make([]*cabinet.CommitFuture, 0)
+
+	for f := 0; f < TestParallelSize; f++ {
+		cds := &cabinet.Transaction{}
+		cds.Setup(context.Background(), mock)
+		cds.EdgeUpdate(MockRandomEdge())
+		cds.EdgeUpdate(MockRandomEdge())
+
+		futures = append(futures, cds.CommitAsync())
+	}
+
+	for f := range futures {
+		if err := futures[f].Wait(); err != nil {
+			t.Errorf("CommitAsync(%d).Wait() = %v", f, err)
+		}
+	}
+
+	if len(mock.Commits()) != TestParallelSize {
+		t.Errorf("expected %d commits, got %d", TestParallelSize, len(mock.Commits()))
+	}
+}
+
+func TestTransactionCommitCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cds := cabinet.Transaction{}
+	cds.Setup(ctx, &MockCabinet{})
+	cds.EdgeUpdate(MockRandomEdge())
+
+	err := cds.Commit()
+
+	if !errors.Is(err, cabinet.ErrCanceled) {
+		t.Errorf("expected a cancelled commit, got %v", err)
+	}
+}
+
+func TestTransactionCommitIdMap(t *testing.T) {
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), &MockCabinet{createIDs: true})
+	cds.NodeCreate(&pb.Node{Type: 1, Id: MockRandomNodeID()})
+	tmp := cds.NodeCreate(&pb.Node{Type: 1})
+
+	if err := cds.CommitAsync().Wait(); err != nil {
+		t.Fatalf("CommitAsync().Wait() = %v", err)
+	}
+
+	if ids := cds.GetIdMap(); len(ids) != 1 || ids[tmp.TmpID()] == "" {
+		t.Errorf("expected only %s to be mapped, got %v", tmp.TmpID(), ids)
+	}
+}
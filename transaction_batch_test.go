@@ -0,0 +1,153 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func batchIncrement(nodeID string) *pb.TransactionAction {
+	return &pb.TransactionAction{Action: &pb.TransactionAction_CounterIncrement{
+		CounterIncrement: &pb.Counter{Object: &pb.Counter_Node{Node: nodeID}, Counter: 1, Value: 1},
+	}}
+}
+
+func TestTransactionBatcher(t *testing.T) {
+	mock := &MockCabinet{}
+	batcher := cabinet.NewBatcher(context.Background(), mock, &cabinet.BatchPolicy{MaxActions: 4, Interval: time.Hour})
+
+	var wg sync.WaitGroup
+	futures := make(chan *cabinet.ActionFuture, 10)
+
+	for w := 0; w < 10; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			f, err := batcher.Add(batchIncrement(MockRandomNodeID()))
+
+			if err != nil {
+				t.Errorf("Add() = %v", err)
+				return
+			}
+
+			futures <- f
+		}()
+	}
+
+	wg.Wait()
+	close(futures)
+
+	// the interval never elapses, the last 2 actions are only sent by Flush()
+	if err := batcher.Flush(); err != nil {
+		t.Errorf("Flush() = %v", err)
+	}
+
+	for f := range futures {
+		if err := f.Wait(); err != nil {
+			t.Errorf("batched action failed: %v", err)
+		} else if !f.Result().Done() {
+			t.Errorf("action %d has no response", f.Result().ActionId)
+		}
+	}
+
+	sizes := make([]int, 0)
+
+	for _, commit := range mock.Commits() {
+		sizes = append(sizes, len(commit))
+	}
+
+	if len(sizes) != 3 || sizes[0] != 4 || sizes[1] != 4 || sizes[2] != 2 {
+		t.Errorf("expected batches of 4, 4 and 2 actions, got %v", sizes)
+	}
+
+	if err := batcher.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+
+	if _, err := batcher.Add(batchIncrement(MockRandomNodeID())); !errors.Is(err, cabinet.ErrBatcherClosed) {
+		t.Errorf("Add() after Close() = %v", err)
+	}
+
+	timed := cabinet.NewBatcher(context.Background(), mock, &cabinet.BatchPolicy{MaxActions: 4, Interval: time.Millisecond})
+
+	if f, err := timed.Add(batchIncrement(MockRandomNodeID())); err != nil || f.Wait() != nil {
+		t.Errorf("expected the interval to commit a partial batch, got %v", err)
+	}
+}
+
+func TestTransactionBatcherFlush(t *testing.T) {
+	mock := &MockCabinet{rejectStream: 1}
+	batcher := cabinet.NewBatcher(context.Background(), mock, &cabinet.BatchPolicy{MaxActions: 100})
+
+	failed, _ := batcher.Add(batchIncrement(MockRandomNodeID()))
+
+	if err := batcher.Flush(); !errors.Is(err, cabinet.ErrInternal) {
+		t.Fatalf("Flush() = %v", err)
+	}
+
+	committed, _ := batcher.Add(batchIncrement(MockRandomNodeID()))
+
+	if err := batcher.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	if !errors.Is(failed.Wait(), cabinet.ErrInternal) || committed.Wait() != nil {
+		t.Errorf("futures reported %v and %v", failed.Wait(), committed.Wait())
+	}
+
+	if failed.Transaction() == committed.Transaction() {
+		t.Errorf("flushed actions landed in the same transaction")
+	}
+}
+
+func TestTransactionBatcherRejectsInvalid(t *testing.T) {
+	mock := &MockCabinet{}
+	batcher := cabinet.NewBatcher(context.Background(), mock, &cabinet.BatchPolicy{MaxActions: 100})
+
+	valid, err := batcher.Add(batchIncrement(MockRandomNodeID()))
+
+	if err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+
+	var validationErr *cabinet.ValidationError
+	if f, err := batcher.Add(batchIncrement("not-a-ksuid")); !errors.As(err, &validationErr) || f != nil {
+		t.Errorf("expected the malformed action to be rejected, got %v, %v", f, err)
+	}
+
+	for _, o := range []*pb.TransactionAction{
+		{Action: &pb.TransactionAction_NodeCreate{NodeCreate: &pb.Node{Type: 1, Id: "tmp:1"}}},
+		batchIncrement("tmp:1"),
+		{Action: &pb.TransactionAction_ReadCheck{ReadCheck: &pb.ReadCheckRequest{
+			Source: "n/1/" + MockRandomNodeID(), Operator: pb.CheckOperators_EXISTS, Target: &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: "*"}},
+		}}},
+	} {
+		if f, err := batcher.Add(o); !errors.As(err, &validationErr) || f != nil {
+			t.Errorf("expected %v to be rejected from a shared batch, got %v, %v", o.Action, f, err)
+		}
+	}
+
+	if err := batcher.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	if err := valid.Wait(); err != nil {
+		t.Errorf("valid action failed: %v", err)
+	}
+
+	if commits := mock.Commits(); len(commits) != 1 || len(commits[0]) != 1 {
+		t.Errorf("expected only the valid action to be sent, got %v", commits)
+	}
+}
@@ -0,0 +1,109 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTransactionCompareAndSwap(t *testing.T) {
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), nil)
+
+	n1 := &pb.Node{Type: 3, Id: MockRandomNodeID(), Properties: []byte("new")}
+	h := cds.CompareAndSwapNode([]byte("old"), n1)
+
+	results := cds.Results()
+
+	if len(results) != 2 || h.Kind() != cabinet.ACTION_NODE_UPDATE {
+		t.Fatalf("expected a guard and an update, got %d actions", len(results))
+	}
+
+	if rc := results[0].ReadCheck(); rc == nil || rc.Source != fmt.Sprintf("n/3/%s", n1.Id) || rc.Operator != pb.CheckOperators_EQUAL || rc.Target.GetVal() != "old" {
+		t.Errorf("unexpected guard %v", results[0].Action)
+	}
+}
+
+func TestTransactionCompareAndSwapNode(t *testing.T) {
+	it := CabinetTest{test: t}
+	it.setup(2)
+
+	p1, p2 := MockRandomPayload(), MockRandomPayload()
+	n1 := &pb.Node{Type: uint32(MockRandomInt(1, 65000)), Version: 1, Id: "tmp:1", Properties: p1}
+
+	mapIDs := CDSTransactionRunner(&([]pb.TransactionAction{
+		{ActionId: 1, Action: &pb.TransactionAction_NodeCreate{NodeCreate: n1}},
+	}), &it)
+
+	n1.Id = mapIDs["tmp:1"]
+
+	cds := cabinet.Transaction{}
+	cds.Setup(it.ctx, it.client)
+	cds.CompareAndSwapNode([]byte("not good"), nodeWithPayload(n1, p2))
+
+	checkTransactionFailed(&it, cds.Commit(), cabinet.ErrReadCheckFailed)
+
+	// should still have p1
+	el1, err := it.client.NodeGet(it.ctx, &pb.NodeGetRequest{NodeType: n1.Type, Id: n1.Id})
+	it.logThing(el1, err, "NodeGet")
+	validatePayload(el1, &it, p1, el1.Properties)
+
+	cds2 := cabinet.Transaction{}
+	cds2.Setup(it.ctx, it.client)
+	cds2.CompareAndSwapNode(p1, nodeWithPayload(n1, p2))
+
+	checkTransactionSuccess(&it, cds2.Commit())
+
+	el2, err := it.client.NodeGet(it.ctx, &pb.NodeGetRequest{NodeType: n1.Type, Id: n1.Id})
+	it.logThing(el2, err, "NodeGet")
+	validatePayload(el2, &it, p2, el2.Properties)
+
+	it.tearDown()
+}
+
+func TestTransactionModifyNode(t *testing.T) {
+	n1 := &pb.Node{Type: 3, Id: MockRandomNodeID(), Properties: []byte("1")}
+	mock := &MockCabinet{nodes: map[string]*pb.Node{n1.Id: n1}, failReadChecks: 2}
+
+	policy := cabinet.DefaultModifyPolicy()
+	policy.InitialBackoff = time.Millisecond
+	calls := 0
+
+	err := cabinet.ModifyNode(context.Background(), mock, &pb.Node{Type: 3, Id: n1.Id}, func(current []byte) ([]byte, error) {
+		calls += 1
+		return append(current, '+'), nil
+	}, policy)
+
+	if err != nil {
+		t.Fatalf("ModifyNode() = %v", err)
+	}
+
+	if calls != 3 || mock.Streams() != 3 {
+		t.Errorf("expected 3 read-modify-write rounds, got %d calls and %d streams", calls, mock.Streams())
+	}
+
+	if current, _ := mock.NodeGet(context.Background(), &pb.NodeGetRequest{NodeType: 3, Id: n1.Id}); string(current.Properties) != "1+" {
+		t.Errorf("node properties are %q", current.Properties)
+	}
+
+	mock.failReadChecks = 10
+	policy.MaxAttempts = 2
+
+	err = cabinet.ModifyNode(context.Background(), mock, &pb.Node{Type: 3, Id: n1.Id}, func(current []byte) ([]byte, error) {
+		return current, nil
+	}, policy)
+
+	if !errors.Is(err, cabinet.ErrReadCheckFailed) {
+		t.Errorf("expected the read check failure after 2 attempts, got %v", err)
+	}
+}
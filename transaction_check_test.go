@@ -0,0 +1,105 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	"cds.ikigai.net/cabinet.v1.test/cabinet/iri"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTransactionCheckBuilder(t *testing.T) {
+	node := iri.Node{Type: 3, Id: MockRandomNodeID()}.String()
+	other := iri.Node{Type: 3, Id: MockRandomNodeID()}.String()
+
+	cases := []struct {
+		cond     *cabinet.Condition
+		operator pb.CheckOperators
+		val      string
+		iri      string
+	}{
+		{cabinet.Check(node).Exists(), pb.CheckOperators_EXISTS, "*", ""},
+		{cabinet.Check(node).Touch(), pb.CheckOperators_TOUCH, "*", ""},
+		{cabinet.Check(node).Equals("cats"), pb.CheckOperators_EQUAL, "cats", ""},
+		{cabinet.Check(node).NotEquals("dogs"), pb.CheckOperators_NOT_EQUAL, "dogs", ""},
+		{cabinet.Check(node).EqualsObject(other), pb.CheckOperators_EQUAL, "", other},
+		{cabinet.Check(node).NotEqualsObject(other), pb.CheckOperators_NOT_EQUAL, "", other},
+	}
+
+	for _, c := range cases {
+		rq, err := c.cond.Request()
+
+		if err != nil {
+			t.Errorf("Request() = %v", err)
+		} else if rq.Source != node || rq.Operator != c.operator || rq.Target.GetVal() != c.val || rq.Target.GetIri() != c.iri {
+			t.Errorf("unexpected request %v", rq)
+		}
+
+		if o, err := c.cond.Action(); err != nil || cabinet.KindOf(o) != cabinet.ACTION_READ_CHECK {
+			t.Errorf("Action() = %v, %v", o, err)
+		}
+	}
+
+	wildcard := fmt.Sprintf("m/n/%s/*", MockRandomNodeID())
+
+	if err := cabinet.Check(wildcard).Exists().Err(); err != nil {
+		t.Errorf("Exists() on a wildcard = %v", err)
+	}
+
+	for _, cond := range []*cabinet.Condition{
+		cabinet.Check(wildcard).Equals("cats"),
+		cabinet.Check(node).EqualsObject(wildcard),
+	} {
+		if _, err := cond.Request(); !errors.Is(err, cabinet.ErrWildcard) {
+			t.Errorf("expected a wildcard error, got %v", err)
+		}
+	}
+
+	if _, err := cabinet.Check("n/3/not-a-ksuid").Exists().Action(); !errors.Is(err, iri.ErrMalformed) {
+		t.Errorf("expected a malformed source to be rejected, got %v", err)
+	}
+
+	if _, err := cabinet.Check(node).NotEqualsObject("x/1").Run(context.Background(), &MockCabinet{}); !errors.Is(err, iri.ErrMalformed) {
+		t.Errorf("Run() of a malformed condition = %v", err)
+	}
+}
+
+func TestTransactionCheckRequire(t *testing.T) {
+	mock := &MockCabinet{}
+	nodeID := MockRandomNodeID()
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.Require(cabinet.Check(iri.Node{Type: 1, Id: nodeID}.String()).Equals("old"))
+	cds.NodeUpdate(&pb.Node{Type: 1, Id: nodeID, Properties: []byte("new")})
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	if rc := mock.Commits()[0][0].GetReadCheck(); rc == nil || rc.Target.GetVal() != "old" {
+		t.Errorf("expected the read check to be sent first, got %v", mock.Commits()[0])
+	}
+
+	invalid := cabinet.Transaction{}
+	invalid.Setup(context.Background(), mock)
+	invalid.Require(cabinet.Check("n/1/tmp:1").Exists())
+	invalid.NodeUpdate(&pb.Node{Type: 1, Id: nodeID})
+
+	var trxErr *cabinet.TransactionError
+	if err := invalid.Commit(); !errors.As(err, &trxErr) || trxErr.Class() != cabinet.TRANSACTION_ERROR_VALIDATION || !errors.Is(err, iri.ErrMalformed) {
+		t.Errorf("expected the malformed condition to fail validation, got %v", err)
+	}
+
+	if mock.Streams() != 1 {
+		t.Errorf("an invalid transaction opened a stream")
+	}
+}
@@ -0,0 +1,153 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTransactionChunkByCount(t *testing.T) {
+	mock := &MockCabinet{}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.SetChunking(&cabinet.ChunkPolicy{MaxActions: 10})
+
+	for i := 0; i < 25; i++ {
+		cds.EdgeUpdate(MockRandomEdge())
+	}
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	sizes := []int{10, 10, 5}
+	commits := mock.Commits()
+
+	if len(commits) != len(sizes) || len(cds.Chunks()) != len(sizes) {
+		t.Fatalf("expected %d chunks, got %d streams and %d chunks", len(sizes), len(commits), len(cds.Chunks()))
+	}
+
+	for c := range sizes {
+		if len(commits[c]) != sizes[c] {
+			t.Errorf("chunk %d got %d actions, expected %d", c, len(commits[c]), sizes[c])
+		}
+	}
+}
+
+func TestTransactionChunkByBytes(t *testing.T) {
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), &MockCabinet{})
+	cds.SetChunking(&cabinet.ChunkPolicy{MaxBytes: 256})
+
+	for i := 0; i < 20; i++ {
+		cds.NodeUpdate(&pb.Node{Type: 1, Id: MockRandomNodeID(), Properties: MockRandomBytes(100)})
+	}
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	for _, chunk := range cds.Chunks() {
+		if chunk.Bytes > 256 {
+			t.Errorf("chunk %d is %d bytes", chunk.Index, chunk.Bytes)
+		}
+	}
+}
+
+func TestTransactionChunkResume(t *testing.T) {
+	mock := &MockCabinet{rejectStream: 2}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.SetChunking(&cabinet.ChunkPolicy{MaxActions: 4})
+
+	for i := 0; i < 10; i++ {
+		cds.EdgeUpdate(MockRandomEdge())
+	}
+
+	var chunkErr *cabinet.ChunkError
+	if err := cds.Commit(); !errors.As(err, &chunkErr) {
+		t.Fatalf("expected a ChunkError, got %v", err)
+	}
+
+	if chunkErr.Failed != 1 || len(chunkErr.Committed) != 1 {
+		t.Errorf("expected chunk 1 to fail after chunk 0, got %v", chunkErr)
+	}
+
+	// the remaining 6 actions are sent again, the first chunk is not
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("resumed Commit() = %v", err)
+	}
+
+	sent := 0
+	for _, commit := range mock.Commits() {
+		sent += len(commit)
+	}
+
+	if sent != 10 {
+		t.Errorf("expected 10 actions sent in total, got %d", sent)
+	}
+}
+
+func TestTransactionChunkReadCheck(t *testing.T) {
+	mock := &MockCabinet{}
+	nodeID := MockRandomNodeID()
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.SetChunking(&cabinet.ChunkPolicy{MaxActions: 4})
+
+	for i := 0; i < 3; i++ {
+		cds.EdgeUpdate(MockRandomEdge()) // 1-3
+	}
+
+	cds.Require(cabinet.Check("n/1/" + nodeID).Exists()) // 4: would close the first chunk
+	cds.EdgeUpdate(MockRandomEdge())                     // 5
+	cds.EdgeUpdate(MockRandomEdge())                     // 6
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	commits := mock.Commits()
+
+	if len(commits) != 2 || len(commits[0]) != 3 || len(commits[1]) != 3 || commits[1][0].GetReadCheck() == nil {
+		t.Fatalf("expected the read check to open the second chunk, got %v", commits)
+	}
+
+	tooLong := cabinet.Transaction{}
+	tooLong.Setup(context.Background(), mock)
+	tooLong.SetChunking(&cabinet.ChunkPolicy{MaxActions: 2})
+	tooLong.Require(cabinet.Check("n/1/" + nodeID).Exists())
+	tooLong.EdgeUpdate(MockRandomEdge())
+	tooLong.EdgeUpdate(MockRandomEdge())
+	tooLong.SetUndo(true)
+
+	var validationErr *cabinet.ValidationError
+	if err := tooLong.Validate(); !errors.As(err, &validationErr) || fmt.Sprint(validationErr.ActionIDs()) != "[1]" {
+		t.Errorf("expected Validate() to report the read check guarding more than a chunk, got %v", err)
+	}
+
+	var trxErr *cabinet.TransactionError
+	if err := tooLong.Commit(); !errors.As(err, &trxErr) || trxErr.Class() != cabinet.TRANSACTION_ERROR_VALIDATION || trxErr.ActionID() != 1 {
+		t.Errorf("expected a read check guarding more than a chunk to fail validation, got %v", err)
+	}
+
+	if tooLong.State() != cabinet.STATE_BUILDING {
+		t.Errorf("a transaction failing validation is %s", tooLong.State())
+	}
+
+	if len(mock.Commits()) != 2 {
+		t.Errorf("a rejected chunked commit was sent")
+	}
+}
@@ -0,0 +1,160 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	"cds.ikigai.net/cabinet.v1.test/cabinet/codecs"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type codecPet struct {
+	Name  string   `json:"name" codec:"name"`
+	Age   int      `json:"age" codec:"age"`
+	Toys  []string `json:"toys" codec:"toys"`
+	Brave bool     `json:"brave" codec:"brave"`
+}
+
+func TestTransactionCodecRoundTrip(t *testing.T) {
+	pet := codecPet{Name: "Tom", Age: 4, Toys: []string{"ball", "mouse"}, Brave: true}
+
+	for _, c := range []cabinet.Codec{cabinet.JSONCodec, codecs.Msgpack, codecs.CBOR} {
+		data, err := c.Marshal(pet)
+
+		if err != nil {
+			t.Fatalf("%s Marshal() = %v", c.Name(), err)
+		}
+
+		var decoded codecPet
+		if err := c.Unmarshal(data, &decoded); err != nil || !reflect.DeepEqual(decoded, pet) {
+			t.Errorf("%s round trip = %v, %v", c.Name(), decoded, err)
+		}
+	}
+
+	if _, err := cabinet.ProtobufCodec.Marshal(pet); err == nil {
+		t.Errorf("protobuf codec encoded a %T", pet)
+	}
+}
+
+type codecBlob struct {
+	Name string `codec:"name"`
+	Note string `codec:"note"`
+	Blob []byte `codec:"blob"`
+}
+
+// TestTransactionCodecMsgpackFixture reads a payload written by the reference msgpack encoder (use_bin_type):
+// a fixstr, a str8 of 40 bytes and a bin8
+func TestTransactionCodecMsgpackFixture(t *testing.T) {
+	fixture := []byte{0x83, 0xa4, 'n', 'a', 'm', 'e', 0xa3, 'T', 'o', 'm', 0xa4, 'n', 'o', 't', 'e', 0xd9, 40}
+	fixture = append(fixture, bytes.Repeat([]byte{'a'}, 40)...)
+	fixture = append(fixture, 0xa4, 'b', 'l', 'o', 'b', 0xc4, 2, 0x01, 0xff)
+
+	expected := codecBlob{Name: "Tom", Note: strings.Repeat("a", 40), Blob: []byte{0x01, 0xff}}
+
+	var decoded codecBlob
+	if err := codecs.Msgpack.Unmarshal(fixture, &decoded); err != nil || !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Unmarshal() = %v, %v; expected %v", decoded, err, expected)
+	}
+
+	if encoded, err := codecs.Msgpack.Marshal(expected); err != nil || !bytes.Equal(encoded, fixture) {
+		t.Errorf("Marshal() = % x, %v; expected % x", encoded, err, fixture)
+	}
+}
+
+func TestTransactionCodecRegistry(t *testing.T) {
+	registry := cabinet.NewCodecRegistry(cabinet.JSONCodec)
+	registry.SetNodeCodec(7, codecs.Msgpack)
+	registry.SetEdgeCodec(9, codecs.CBOR)
+	registry.SetMetaCodec(3, codecs.CBOR)
+
+	for _, c := range []struct {
+		object   *pb.Node
+		expected cabinet.Codec
+	}{
+		{&pb.Node{Type: 7}, codecs.Msgpack},
+		{&pb.Node{Type: 8}, cabinet.JSONCodec},
+	} {
+		if codec := registry.CodecOf(c.object); codec != c.expected {
+			t.Errorf("CodecOf(%v) = %v; expected %s", c.object, codec, c.expected.Name())
+		}
+	}
+
+	if codec := registry.CodecOf(&pb.Edge{Predicate: 9}); codec != codecs.CBOR {
+		t.Errorf("edge codec = %v", codec)
+	}
+
+	meta := &pb.Meta{Object: &pb.Meta_Node{Node: MockRandomNodeID()}, Key: 3}
+
+	if err := registry.Encode(meta, map[string]int{"legs": 4}); err != nil {
+		t.Fatalf("Encode() = %v", err)
+	}
+
+	legs := map[string]int{}
+	if err := registry.Decode(meta, &legs); err != nil || legs["legs"] != 4 {
+		t.Errorf("Decode() = %v, %v", legs, err)
+	}
+
+	var untouched codecPet
+	if err := registry.Decode(&pb.Node{Type: 7}, &untouched); err != nil || untouched.Name != "" {
+		t.Errorf("Decode() of an empty payload = %v, %v", untouched, err)
+	}
+
+	if err := registry.Encode(&pb.NodeGetRequest{}, untouched); err == nil {
+		t.Errorf("Encode() accepted a message without payload")
+	}
+}
+
+func TestTransactionCodecHelpers(t *testing.T) {
+	registry := cabinet.NewCodecRegistry(cabinet.JSONCodec)
+	registry.SetNodeCodec(7, codecs.Msgpack)
+
+	nodeID := MockRandomNodeID()
+	mock := &MockCabinet{nodes: map[string]*pb.Node{nodeID: {Type: 7, Id: nodeID}}}
+
+	pet := codecPet{Name: "Tom", Age: 5, Toys: []string{"yarn"}}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+
+	if _, err := registry.NodeUpdate(&cds, &pb.Node{Type: 7, Id: nodeID}, pet); err != nil {
+		t.Fatalf("NodeUpdate() = %v", err)
+	}
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	var stored codecPet
+	if n, err := registry.NodeGet(context.Background(), mock, &pb.NodeGetRequest{NodeType: 7, Id: nodeID}, &stored); err != nil || n.Id != nodeID {
+		t.Fatalf("NodeGet() = %v, %v", n, err)
+	}
+
+	if !reflect.DeepEqual(stored, pet) {
+		t.Errorf("NodeGet() decoded %v; expected %v", stored, pet)
+	}
+
+	created := cabinet.Transaction{}
+	created.Setup(context.Background(), mock)
+
+	if h, err := registry.NodeCreate(&created, &pb.Node{Type: 7}, pet); err != nil || h.TmpID() != "tmp:1" {
+		t.Errorf("NodeCreate() = %v, %v; expected a temporary ID", h, err)
+	}
+
+	if err := created.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	raw, _ := codecs.Msgpack.Marshal(pet)
+	if sent := mock.Commits()[0][0].GetNodeUpdate(); sent == nil || string(sent.Properties) != string(raw) {
+		t.Errorf("expected msgpack properties to be sent, got %v", mock.Commits()[0])
+	}
+}
@@ -7,6 +7,7 @@
 package main
 
 import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
 	pb "cds.ikigai.net/cabinet.v1/rpc"
 	"testing"
 )
@@ -244,3 +245,59 @@ func TestTransactionEdgeMultiClear(t *testing.T) {
 
 	it.tearDown()
 }
+
+func TestTransactionEdgeTmpNodes(t *testing.T) {
+	it := CabinetTest{test: t}
+	it.setup(4)
+
+	payload1, payload2 := MockRandomPayload(), MockRandomPayload()
+	nodeType := uint32(MockRandomInt(10, 10000))
+
+	cds := cabinet.Transaction{}
+	cds.Setup(it.ctx, it.client)
+
+	h1 := cds.NodeCreate(&pb.Node{Type: nodeType, Version: 1})
+	h2 := cds.NodeCreate(&pb.Node{Type: nodeType, Version: 1})
+
+	e1 := &pb.Edge{Subject: h1.TmpID(), Predicate: uint32(MockRandomInt(10, 10000)), Target: h2.TmpID(), Properties: payload1}
+	m1 := &pb.Meta{Object: &pb.Meta_Node{Node: h2.TmpID()}, Key: uint32(MockRandomInt(10, 10000)), Val: payload2}
+
+	cds.EdgeUpdate(e1)
+	cds.MetaUpdate(m1)
+
+	checkTransactionSuccess(&it, cds.Commit())
+
+	if e1.Subject != h1.NodeID() || e1.Target != h2.NodeID() {
+		it.test.Errorf("edge was not resolved, got %s -> %s expected %s -> %s", e1.Subject, e1.Target, h1.NodeID(), h2.NodeID())
+	}
+
+	r1, err := it.client.EdgeGet(it.ctx, &pb.EdgeGetRequest{Edge: edgeWithoutPayload(e1)})
+	it.logThing(r1, err, "EdgeGet")
+	validatePayload(r1, &it, payload1, r1.Properties)
+
+	r2, err := it.client.MetaGet(it.ctx, metaWithoutPayload(m1))
+	it.logThing(r2, err, "MetaGet")
+	validatePayload(r2, &it, payload2, r2.Val)
+
+	// unknown temporary IDs are refused before anything is sent
+	cds2 := cabinet.Transaction{}
+	cds2.Setup(it.ctx, it.client)
+	cds2.EdgeUpdate(&pb.Edge{Subject: "tmp:404", Predicate: e1.Predicate, Target: h2.NodeID()})
+
+	if err := cds2.Commit(); err == nil {
+		it.test.Errorf("Transaction referencing an unknown temporary ID was committed")
+	} else {
+		it.test.Logf("Transaction was rejected: %v", err)
+	}
+
+	// clean up
+	cds3 := cabinet.Transaction{}
+	cds3.Setup(it.ctx, it.client)
+	cds3.EdgeDelete(edgeWithoutPayload(e1))
+	cds3.MetaDelete(metaWithoutPayload(m1))
+	cds3.NodeDelete(&pb.Node{Type: nodeType, Id: h1.NodeID()})
+	cds3.NodeDelete(&pb.Node{Type: nodeType, Id: h2.NodeID()})
+	checkTransactionSuccess(&it, cds3.Commit())
+
+	it.tearDown()
+}
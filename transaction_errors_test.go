@@ -0,0 +1,52 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestTransactionErrorsDecode(t *testing.T) {
+	catalog := []*cabinet.CabinetError{
+		cabinet.ErrCanceled, cabinet.ErrUnknown, cabinet.ErrInvalidArgument, cabinet.ErrDeadlineExceeded,
+		cabinet.ErrNotFound, cabinet.ErrAlreadyExists, cabinet.ErrPermissionDenied, cabinet.ErrResourceExhausted,
+		cabinet.ErrFailedPrecondition, cabinet.ErrAborted, cabinet.ErrOutOfRange, cabinet.ErrUnimplemented,
+		cabinet.ErrInternal, cabinet.ErrUnavailable, cabinet.ErrDataLoss, cabinet.ErrUnauthenticated,
+	}
+
+	for _, entry := range catalog {
+		err := cabinet.Decode(status.Error(entry.Status, "rejected"))
+
+		if !errors.Is(err, entry) {
+			t.Errorf("Decode(%s) does not match %s", entry.Status, entry.Name)
+		}
+
+		for _, other := range catalog {
+			if other != entry && errors.Is(err, other) {
+				t.Errorf("Decode(%s) also matches %s", entry.Status, other.Name)
+			}
+		}
+
+		if errors.Is(err, cabinet.ErrServer) || errors.Is(err, cabinet.ErrTransport) != (entry == cabinet.ErrUnavailable) {
+			t.Errorf("Decode(%s) matches the wrong groups", entry.Status)
+		}
+	}
+
+	err := cabinet.Decode(status.Error(codes.FailedPrecondition, "E(0x013) read check failed"))
+
+	if !errors.Is(err, cabinet.ErrReadCheckFailed) || !errors.Is(err, cabinet.ErrServer) || !errors.Is(err, cabinet.ErrFailedPrecondition) {
+		t.Errorf("Decode() of a server code = %v", err)
+	}
+
+	if cabinet.Decode(nil) != nil {
+		t.Errorf("Decode(nil) is not nil")
+	}
+}
@@ -0,0 +1,117 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestTransactionHooks(t *testing.T) {
+	mock := &MockCabinet{}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+
+	var mux sync.Mutex
+	calls := make([]string, 0)
+	record := func(format string, args ...interface{}) {
+		mux.Lock()
+		calls = append(calls, fmt.Sprintf(format, args...))
+		mux.Unlock()
+	}
+
+	nodeID := MockRandomNodeID()
+	responses := 0
+
+	cds.Use(&cabinet.Hooks{
+		AroundCommit: func(ctx context.Context, trx *cabinet.Transaction, next cabinet.CommitFunc) error {
+			record("outer")
+			trx.ReadCheck(&pb.ReadCheckRequest{
+				Source: "n/1/" + nodeID, Operator: pb.CheckOperators_EXISTS, Target: &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: "*"}},
+			})
+
+			return next(ctx)
+		},
+		BeforeSend: func(ctx context.Context, o *pb.TransactionAction) error {
+			record("audit %d", o.ActionId)
+			return nil
+		},
+	}, &cabinet.Hooks{
+		AroundCommit: func(ctx context.Context, trx *cabinet.Transaction, next cabinet.CommitFunc) error {
+			record("inner")
+			return next(ctx)
+		},
+		BeforeSend: func(ctx context.Context, o *pb.TransactionAction) error {
+			if nu, isUpdate := o.Action.(*pb.TransactionAction_NodeUpdate); isUpdate {
+				nu.NodeUpdate.Properties = []byte("redacted")
+			}
+
+			return nil
+		},
+		AfterResponse: func(ctx context.Context, o *pb.TransactionAction, r *pb.TransactionActionResponse) {
+			responses += 1
+		},
+	})
+
+	cds.NodeUpdate(&pb.Node{Type: 1, Id: nodeID, Properties: []byte("secret")})
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	if expected := []string{"outer", "inner", "audit 1", "audit 2"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("hooks ran as %v, expected %v", calls, expected)
+	}
+
+	sent := mock.Commits()[0]
+
+	if len(sent) != 2 || string(sent[0].GetNodeUpdate().Properties) != "redacted" || responses != 2 {
+		t.Errorf("sent %v with %d responses", sent, responses)
+	}
+
+	if string(cds.Results()[0].Node().Properties) != "secret" {
+		t.Errorf("BeforeSend modified the queued action")
+	}
+}
+
+func TestTransactionHooksVeto(t *testing.T) {
+	mock := &MockCabinet{}
+	forbidden := errors.New("node deletes are not allowed")
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.Use(&cabinet.Hooks{
+		BeforeSend: func(ctx context.Context, o *pb.TransactionAction) error {
+			if cabinet.KindOf(o) == cabinet.ACTION_NODE_DELETE {
+				return forbidden
+			}
+
+			return nil
+		},
+	})
+
+	cds.NodeUpdate(&pb.Node{Type: 1, Id: MockRandomNodeID()})
+	cds.NodeDelete(&pb.Node{Type: 1, Id: MockRandomNodeID()})
+
+	err := cds.Commit()
+
+	var trxErr *cabinet.TransactionError
+	if !errors.As(err, &trxErr) || trxErr.Class() != cabinet.TRANSACTION_ERROR_VETO || trxErr.ActionID() != 2 || !errors.Is(err, forbidden) {
+		t.Fatalf("expected a veto of action 2, got %v", err)
+	}
+
+	if mock.Streams() != 0 {
+		t.Errorf("a vetoed transaction opened %d stream(s)", mock.Streams())
+	}
+}
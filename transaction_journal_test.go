@@ -0,0 +1,71 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"github.com/golang/protobuf/proto"
+	"testing"
+)
+
+func TestTransactionJournalRoundTrip(t *testing.T) {
+	for _, format := range []cabinet.JournalFormat{cabinet.JOURNAL_PROTO, cabinet.JOURNAL_JSONL} {
+		cds := cabinet.Transaction{}
+		cds.Setup(context.Background(), &MockCabinet{})
+
+		cds.NodeCreate(&pb.Node{Type: 1, Id: "tmp:1", Properties: MockRandomBytes(40)})
+		cds.EdgeUpdate(&pb.Edge{Subject: "tmp:1", Predicate: 10, Target: MockRandomNodeID(), Properties: MockRandomBytes(10)})
+		cds.MetaUpdate(&pb.Meta{Object: &pb.Meta_Edge{Edge: &pb.Edge{Subject: "tmp:1", Predicate: 10, Target: MockRandomNodeID()}}, Key: 3, Val: MockRandomBytes(8)})
+		cds.CounterIncrement(&pb.Counter{Object: &pb.Counter_Node{Node: "tmp:1"}, Counter: 2, Value: -5})
+
+		original := cds.Journal().Actions
+
+		if err := cds.Commit(); err != nil {
+			t.Fatalf("Commit() = %v", err)
+		}
+
+		var buf bytes.Buffer
+		if err := cds.WriteJournal(&buf, format); err != nil {
+			t.Fatalf("format %d: WriteJournal() = %v", format, err)
+		}
+
+		j, err := cabinet.ReadJournal(bytes.NewReader(buf.Bytes()), format)
+
+		if err != nil {
+			t.Fatalf("format %d: ReadJournal() = %v", format, err)
+		}
+
+		if len(j.Actions) != len(original) || j.Header.TmpIDs[1] != "tmp:1" || j.Header.State != "committed" {
+			t.Fatalf("format %d: read %d actions, header %+v", format, len(j.Actions), j.Header)
+		}
+
+		// committed actions carry real IDs, the journal keeps the temporary ones
+		for i := range original {
+			if !proto.Equal(j.Actions[i], original[i]) {
+				t.Errorf("format %d: action %d got %v expected %v", format, i, j.Actions[i], original[i])
+			}
+		}
+
+		replayMock := &MockCabinet{}
+		replay, err := j.Replay(context.Background(), replayMock)
+
+		if err != nil {
+			t.Fatalf("format %d: Replay() = %v", format, err)
+		}
+
+		if replay.State() != cabinet.STATE_COMMITTED || len(replayMock.Commits()[0]) != len(original) {
+			t.Errorf("format %d: replay state %s, sent %v", format, replay.State(), replayMock.Commits())
+		}
+
+		if _, err := cabinet.ReadJournal(bytes.NewReader(buf.Bytes()[:buf.Len()-3]), format); err == nil {
+			t.Errorf("format %d: a truncated journal was accepted", format)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransactionMetrics(t *testing.T) {
+	metrics := cabinet.NewMetrics()
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), &MockCabinet{})
+	cds.Use(metrics.Hooks())
+
+	cds.NodeUpdate(&pb.Node{Type: 1, Id: MockRandomNodeID()})
+	cds.NodeUpdate(&pb.Node{Type: 1, Id: MockRandomNodeID()})
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	failing := cabinet.Transaction{}
+	failing.Setup(context.Background(), &MockCabinet{rejectStream: 1})
+	failing.SetRetryPolicy(nil)
+	failing.Use(metrics.Hooks())
+	failing.NodeDelete(&pb.Node{Type: 1, Id: MockRandomNodeID()})
+
+	if err := failing.Commit(); err == nil {
+		t.Fatalf("expected the rejected stream to fail the commit")
+	}
+
+	vetoed := cabinet.Transaction{}
+	vetoed.Setup(context.Background(), &MockCabinet{})
+	vetoed.Use(metrics.Hooks(), &cabinet.Hooks{BeforeSend: func(ctx context.Context, o *pb.TransactionAction) error {
+		return errors.New("vetoed")
+	}})
+	vetoed.NodeCreate(&pb.Node{Type: 1})
+
+	if err := vetoed.Commit(); err == nil {
+		t.Fatalf("expected the veto to fail the commit")
+	}
+
+	retried := cabinet.Transaction{}
+	retried.Setup(context.Background(), &MockCabinet{failConnections: 1})
+	retried.SetRetryPolicy(mockRetryPolicy(2))
+	retried.Use(metrics.Hooks())
+	retried.EdgeUpdate(MockRandomEdge())
+
+	if err := retried.Commit(); err != nil || retried.Attempts() != 2 {
+		t.Fatalf("Commit() = %v after %d attempt(s), expected a retried success", err, retried.Attempts())
+	}
+
+	intercept := metrics.UnaryClientInterceptor()
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.NotFound, "not found")
+	}
+
+	intercept(context.Background(), "/CDSCabinet/NodeGet", &pb.NodeGetRequest{}, &pb.Node{}, nil, invoker)
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	scrape := rec.Body.String()
+
+	for _, line := range []string{
+		"# TYPE cabinet_rpc_duration_seconds histogram",
+		`cabinet_rpc_calls_total{method="NodeGet",code="NotFound"} 1`,
+		`cabinet_rpc_duration_seconds_count{method="NodeGet"} 1`,
+		`cabinet_transaction_commits_total{result="committed"} 2`,
+		`cabinet_transaction_commits_total{result="failed"} 2`,
+		`cabinet_transaction_errors_total{class="conn"} 1`,
+		`cabinet_transaction_sent_actions_total{kind="NodeUpdate"} 2`,
+		`cabinet_transaction_sent_actions_total{kind="EdgeUpdate"} 1`,
+		`cabinet_transaction_actions_bucket{le="1"} 3`,
+		`cabinet_transaction_actions_bucket{le="+Inf"} 4`,
+		"cabinet_transaction_actions_sum 5",
+	} {
+		if !strings.Contains(scrape, line+"\n") {
+			t.Errorf("scrape is missing %q:\n%s", line, scrape)
+		}
+	}
+
+	if strings.Contains(scrape, `kind="NodeCreate"`) || strings.Contains(scrape, `kind="NodeDelete"`) {
+		t.Errorf("actions of failed commits were counted as sent:\n%s", scrape)
+	}
+}
@@ -7,6 +7,7 @@
 package main
 
 import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
 	pb "cds.ikigai.net/cabinet.v1/rpc"
 	"testing"
 )
@@ -41,6 +42,49 @@ func TestTransactionNodeSimpleCRUD(t *testing.T) {
 	it.tearDown()
 }
 
+func TestTransactionNodeBuilderCRUD(t *testing.T) {
+	it := CabinetTest{test: t}
+	it.setup(2)
+
+	payload1, payload2 := MockRandomPayload(), MockRandomPayload()
+	nodeType := uint32(1)
+
+	cds := cabinet.Transaction{}
+	cds.Setup(it.ctx, it.client)
+
+	h1 := cds.NodeCreate(&pb.Node{Type: nodeType, Version: 1, Properties: payload1})
+	cds.NodeUpdate(&pb.Node{Type: nodeType, Id: h1.TmpID(), Properties: payload2})
+
+	if h1.Kind() != cabinet.ACTION_NODE_CREATE {
+		it.test.Errorf("handle kind got %s expected %s", h1.Kind(), cabinet.ACTION_NODE_CREATE)
+	}
+
+	checkTransactionSuccess(&it, cds.Commit())
+
+	if realID, created := h1.Result().CreatedNodeID(); !created || realID != h1.NodeID() {
+		it.test.Errorf("NodeCreate result got %s expected %s", realID, h1.NodeID())
+	}
+
+	cds.EachResult(func(r *cabinet.ActionResult) bool {
+		if !r.Done() {
+			it.test.Errorf("no response received for action %d (%s)", r.ActionId, r.Kind)
+		}
+
+		return true
+	})
+
+	el1, err := it.client.NodeGet(it.ctx, &pb.NodeGetRequest{NodeType: nodeType, Id: h1.NodeID()})
+	it.logThing(el1, err, "NodeGet")
+	validatePayload(el1, &it, payload2, el1.Properties)
+
+	cds2 := cabinet.Transaction{}
+	cds2.Setup(it.ctx, it.client)
+	cds2.NodeDelete(&pb.Node{Type: nodeType, Id: h1.NodeID()})
+	checkTransactionSuccess(&it, cds2.Commit())
+
+	it.tearDown()
+}
+
 func TestTransactionNodeMultiCRUD(t *testing.T) {
 	it := CabinetTest{test: t}
 	it.setup(4)
@@ -0,0 +1,162 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTransactionOptimize(t *testing.T) {
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), nil)
+
+	nodeX, nodeY := MockRandomNodeID(), MockRandomNodeID()
+	s1 := &pb.Counter{Object: &pb.Counter_Node{Node: nodeX}, Counter: 1}
+	s2 := &pb.Counter{Object: &pb.Counter_Node{Node: nodeX}, Counter: 2}
+
+	first := counterWithValue(s1, 3)
+	cds.CounterIncrement(first)                                                            // 1
+	cds.CounterIncrement(counterWithValue(s2, 4))                                          // 2
+	cds.CounterIncrement(counterWithValue(s1, -1))                                         // 3: merged into 1
+	cds.NodeCreate(&pb.Node{Type: 1, Properties: []byte("a")})                             // 4
+	cds.NodeUpdate(&pb.Node{Type: 1, Id: "tmp:4", Properties: []byte("b")})                // 5: folded into 4
+	cds.EdgeUpdate(&pb.Edge{Subject: nodeX, Predicate: 10, Target: nodeY})                 // 6: may create the edge
+	cds.EdgeUpdate(&pb.Edge{Subject: nodeX, Predicate: 10, Target: nodeY})                 // 7: dropped by 9
+	cds.MetaUpdate(&pb.Meta{Object: &pb.Meta_Node{Node: nodeX}, Key: 3, Val: []byte("v")}) // 8: may create the meta
+	cds.EdgeClear(&pb.Edge{Subject: nodeX, Predicate: 10, Target: cabinet.WILDCARD})       // 9
+	cds.MetaDelete(&pb.Meta{Object: &pb.Meta_Node{Node: nodeX}, Key: 3})                   // 10
+	cds.ReadCheck(&pb.ReadCheckRequest{
+		Source: "n/1/" + nodeX, Operator: pb.CheckOperators_EXISTS, Target: &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: "*"}},
+	}) // 11
+	cds.CounterIncrement(counterWithValue(s1, 5)) // 12: not merged across the read check
+
+	report, err := cds.Optimize()
+
+	if err != nil {
+		t.Fatalf("Optimize() = %v", err)
+	}
+
+	t.Logf("Optimize: %v", report)
+
+	expected := []uint32{1, 2, 4, 6, 8, 9, 10, 11, 12}
+	results := cds.Results()
+
+	if len(results) != len(expected) || len(report.Rewrites) != 3 {
+		t.Fatalf("expected %d actions and 3 rewrites, got %d and %d", len(expected), len(results), len(report.Rewrites))
+	}
+
+	for i, r := range results {
+		if r.ActionId != expected[i] {
+			t.Errorf("action %d is %d, expected %d", i, r.ActionId, expected[i])
+		}
+	}
+
+	if merged := results[0].Counter(); merged.Value != 2 || first.Value != 3 {
+		t.Errorf("merged increment is %d (caller's copy %d), expected 2 (3)", merged.Value, first.Value)
+	}
+
+	if folded := results[2].Node(); string(folded.Properties) != "b" || folded.Id != "tmp:4" {
+		t.Errorf("folded create is %v", folded)
+	}
+
+	if cds.Results()[8].Counter().Value != 5 {
+		t.Errorf("increment after the read check was changed")
+	}
+}
+
+// TestTransactionOptimizeRecreate keeps the create, delete and create of an index that may not exist yet
+func TestTransactionOptimizeRecreate(t *testing.T) {
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), nil)
+
+	index := &pb.Index{Type: 1, Value: "v", Node: MockRandomNodeID()}
+	cds.IndexCreate(index)
+	cds.IndexDelete(index)
+	cds.IndexCreate(index)
+
+	report, err := cds.Optimize()
+
+	if err != nil {
+		t.Fatalf("Optimize() = %v", err)
+	}
+
+	if len(report.Rewrites) != 0 || len(cds.Results()) != 3 {
+		t.Errorf("expected nothing to be dropped, got %v", report)
+	}
+}
+
+func TestTransactionOptimizeDryRun(t *testing.T) {
+	mock := &MockCabinet{}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.SetOptimize(true)
+
+	s1 := &pb.Counter{Object: &pb.Counter_Node{Node: MockRandomNodeID()}, Counter: 1}
+	first := counterWithValue(s1, 3)
+	cds.CounterIncrement(first)
+	cds.CounterIncrement(counterWithValue(s1, 4))
+
+	var out bytes.Buffer
+	cds.SetDryRun(&out)
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("dry run Commit() = %v", err)
+	}
+
+	if report := cds.Optimized(); report == nil || report.After != 1 || !strings.HasPrefix(out.String(), "1 action(s)") {
+		t.Errorf("dry run optimized %v, wrote:\n%s", report, out.String())
+	}
+
+	if results := cds.Results(); len(results) != 2 || results[0].Counter().Value != 3 || first.Value != 3 {
+		t.Errorf("dry run rewrote the queued actions: %v", results)
+	}
+
+	cds.SetDryRun(nil)
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	if sent := mock.Commits()[0]; len(sent) != 1 || sent[0].GetCounterIncrement().GetValue() != 7 {
+		t.Errorf("expected one merged increment to be sent, got %v", sent)
+	}
+}
+
+func TestTransactionOptimizeFold(t *testing.T) {
+	mock := &MockCabinet{createIDs: true}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+
+	created := &pb.Node{Type: 1, Version: 3, Properties: []byte("a")}
+	cds.NodeCreate(created)
+	cds.NodeUpdate(&pb.Node{Type: 1, Id: "tmp:1", Properties: []byte("b")})
+
+	if _, err := cds.Optimize(); err != nil {
+		t.Fatalf("Optimize() = %v", err)
+	}
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	sent := mock.Commits()[0]
+
+	if len(sent) != 1 || sent[0].GetNodeCreate().GetVersion() != 3 || string(sent[0].GetNodeCreate().GetProperties()) != "b" {
+		t.Errorf("unexpected folded create %v", sent)
+	}
+
+	if realID := cds.GetIdMap()["tmp:1"]; realID == "" || created.Id != realID || created.Version != 3 {
+		t.Errorf("caller's node is %v, expected ID %q", created, realID)
+	}
+}
@@ -0,0 +1,103 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTransactionOrderTmpDependencies(t *testing.T) {
+	mock := &MockCabinet{}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+
+	cds.IndexCreate(&pb.Index{Type: 5, Node: "tmp:5", Value: "cats"})          // 1
+	cds.EdgeUpdate(&pb.Edge{Subject: "tmp:5", Predicate: 10, Target: "tmp:6"}) // 2
+	cds.NodeUpdate(&pb.Node{Type: 1, Id: MockRandomNodeID()})                  // 3
+	cds.NodeCreate(&pb.Node{Type: 1, Id: "tmp:6"})                             // 4
+	cds.NodeCreate(&pb.Node{Type: 1, Id: "tmp:5"})                             // 5
+	cds.MetaUpdate(&pb.Meta{Object: &pb.Meta_Node{Node: "tmp:5"}, Key: 7})     // 6
+
+	expected := []uint32{3, 4, 5, 1, 2, 6}
+	order, err := cds.Order()
+
+	if err != nil {
+		t.Fatalf("Order() = %v", err)
+	}
+
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("order got %v expected %v", order, expected)
+		}
+	}
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	for i, o := range mock.Commits()[0] {
+		if o.ActionId != expected[i] {
+			t.Fatalf("action %d was sent at position %d, expected %d", o.ActionId, i, expected[i])
+		}
+	}
+}
+
+func TestTransactionOrderReadCheckBarrier(t *testing.T) {
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), nil)
+
+	cds.IndexCreate(&pb.Index{Type: 5, Node: "tmp:1", Value: "cats"})
+	cds.ReadCheck(&pb.ReadCheckRequest{
+		Source: "n/1/" + MockRandomNodeID(), Operator: pb.CheckOperators_EXISTS, Target: &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: "*"}},
+	})
+	cds.NodeCreate(&pb.Node{Type: 1, Id: "tmp:1"})
+
+	var trxErr *cabinet.TransactionError
+	if err := cds.Validate(); !errors.As(err, &trxErr) || trxErr.Class() != cabinet.TRANSACTION_ERROR_ORDER {
+		t.Fatalf("expected an order error, got %v", err)
+	}
+}
+
+func TestTransactionOrderCycle(t *testing.T) {
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), nil)
+
+	cds.NodeUpdate(&pb.Node{Type: 1, Id: "tmp:1"})
+	cds.NodeDelete(&pb.Node{Type: 1, Id: "tmp:1"})
+	cds.NodeCreate(&pb.Node{Type: 1, Id: "tmp:1"})
+
+	if order, err := cds.Order(); err != nil || fmt.Sprint(order) != "[3 1 2]" {
+		t.Errorf("expected the create to move before the update and delete, got %v, %v", order, err)
+	}
+
+	// the read check keeps the update before it and the create after it
+	cds.Reset()
+	cds.NodeUpdate(&pb.Node{Type: 1, Id: "tmp:1"})
+	cds.ReadCheck(&pb.ReadCheckRequest{
+		Source: "n/1/" + MockRandomNodeID(), Operator: pb.CheckOperators_EXISTS, Target: &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: "*"}},
+	})
+	cds.NodeCreate(&pb.Node{Type: 1, Id: "tmp:1"})
+
+	err := cds.Commit()
+
+	var trxErr *cabinet.TransactionError
+	if !errors.As(err, &trxErr) || trxErr.Class() != cabinet.TRANSACTION_ERROR_ORDER {
+		t.Fatalf("expected an order error, got %v", err)
+	}
+
+	if trxErr.ActionID() != 1 {
+		t.Errorf("cycle reported on action %d, expected 1", trxErr.ActionID())
+	}
+
+	t.Logf("Transaction was rejected: %v", err)
+}
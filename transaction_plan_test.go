@@ -0,0 +1,84 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTransactionPlanDryRun(t *testing.T) {
+	mock := &MockCabinet{}
+	subject := MockRandomNodeID()
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+
+	cds.EdgeUpdate(&pb.Edge{Subject: subject, Predicate: 10, Target: "tmp:1", Properties: MockRandomBytes(12)})
+	cds.NodeCreate(&pb.Node{Type: 1, Id: "tmp:1", Properties: MockRandomBytes(30)})
+	cds.MetaUpdate(&pb.Meta{Object: &pb.Meta_Node{Node: "tmp:1"}, Key: 7, Val: MockRandomBytes(5)})
+
+	plan, err := cds.Plan()
+
+	if err != nil {
+		t.Fatalf("Plan() = %v", err)
+	}
+
+	expected := []struct {
+		kind    cabinet.ActionKind
+		iri     string
+		payload int
+	}{
+		{cabinet.ACTION_NODE_CREATE, "n/1/tmp:1", 30},
+		{cabinet.ACTION_EDGE_UPDATE, fmt.Sprintf("e/%s/10/tmp:1", subject), 12},
+		{cabinet.ACTION_META_UPDATE, "m/n/tmp:1/7", 5},
+	}
+
+	for i, step := range plan.Steps {
+		if step.Kind != expected[i].kind || step.IRI != expected[i].iri || step.Payload != expected[i].payload {
+			t.Errorf("step %d got %s %s %dB, expected %s %s %dB", i, step.Kind, step.IRI, step.Payload, expected[i].kind, expected[i].iri, expected[i].payload)
+		}
+	}
+
+	if uses := plan.Steps[1].Uses; len(uses) != 1 || uses[0].ActionId != 2 {
+		t.Errorf("edge should use tmp:1 from action 2, got %v", uses)
+	}
+
+	encoded, err := plan.JSON()
+
+	if err != nil {
+		t.Fatalf("JSON() = %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil || !strings.Contains(string(encoded), `"kind": "NodeCreate"`) {
+		t.Errorf("unexpected plan JSON (%v):\n%s", err, encoded)
+	}
+
+	var out bytes.Buffer
+	cds.SetDryRun(&out)
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("dry run Commit() = %v", err)
+	}
+
+	if mock.Streams() != 0 {
+		t.Errorf("dry run opened %d stream(s)", mock.Streams())
+	}
+
+	if out.String() != plan.String() || cds.State() != cabinet.STATE_BUILDING {
+		t.Errorf("dry run state %s, wrote:\n%s", cds.State(), out.String())
+	}
+
+	t.Logf("Plan:\n%s", out.String())
+}
@@ -0,0 +1,137 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// poolTransaction is a one action transaction whose commit waits on hold
+func poolTransaction(mock *MockCabinet, started chan<- struct{}, hold func(ctx context.Context) error) *cabinet.Transaction {
+	trx := &cabinet.Transaction{}
+	trx.Setup(context.Background(), mock)
+	trx.NodeUpdate(&pb.Node{Type: 1, Id: MockRandomNodeID()})
+
+	trx.Use(&cabinet.Hooks{
+		AroundCommit: func(ctx context.Context, trx *cabinet.Transaction, next cabinet.CommitFunc) error {
+			started <- struct{}{}
+
+			if err := hold(ctx); err != nil {
+				return err
+			}
+
+			return next(ctx)
+		},
+	})
+
+	return trx
+}
+
+func TestTransactionPool(t *testing.T) {
+	mock := &MockCabinet{}
+	gate := make(chan struct{})
+	started := make(chan struct{}, 10)
+	hold := func(ctx context.Context) error {
+		<-gate
+		return nil
+	}
+
+	pool := cabinet.NewPool(context.Background(), mock, 1, 1)
+
+	running, err := pool.Submit(context.Background(), poolTransaction(mock, started, hold))
+
+	if err != nil {
+		t.Fatalf("Submit() = %v", err)
+	}
+
+	<-started
+
+	queued, err := pool.Submit(context.Background(), poolTransaction(mock, started, hold))
+
+	if err != nil {
+		t.Fatalf("Submit() = %v", err)
+	}
+
+	if _, err := pool.TrySubmit(poolTransaction(mock, started, hold)); !errors.Is(err, cabinet.ErrPoolFull) {
+		t.Errorf("TrySubmit() on a full queue = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := pool.Submit(ctx, poolTransaction(mock, started, hold)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit() on a full queue = %v", err)
+	}
+
+	close(gate)
+
+	batch, err := pool.SubmitActions(context.Background(), &pb.TransactionAction{
+		Action: &pb.TransactionAction_NodeDelete{NodeDelete: &pb.Node{Type: 1, Id: MockRandomNodeID()}},
+	})
+
+	if err != nil {
+		t.Fatalf("SubmitActions() = %v", err)
+	}
+
+	if err := pool.Close(context.Background()); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	for _, f := range []*cabinet.CommitFuture{running, queued, batch} {
+		if err := f.Wait(); err != nil {
+			t.Errorf("pooled commit failed: %v", err)
+		}
+	}
+
+	if mock.Streams() != 3 {
+		t.Errorf("expected 3 streams, got %d", mock.Streams())
+	}
+
+	if _, err := pool.Submit(context.Background(), poolTransaction(mock, started, hold)); !errors.Is(err, cabinet.ErrPoolClosed) {
+		t.Errorf("Submit() after Close() = %v", err)
+	}
+}
+
+func TestTransactionPoolCloseDeadline(t *testing.T) {
+	mock := &MockCabinet{}
+	started := make(chan struct{}, 10)
+	hold := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	pool := cabinet.NewPool(context.Background(), mock, 1, 1)
+
+	running, _ := pool.Submit(context.Background(), poolTransaction(mock, started, hold))
+	<-started
+	queued, _ := pool.Submit(context.Background(), poolTransaction(mock, started, hold))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := pool.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	if err := running.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("running commit = %v", err)
+	}
+
+	var trxErr *cabinet.TransactionError
+	if err := queued.Wait(); !errors.As(err, &trxErr) || trxErr.Class() != cabinet.TRANSACTION_ERROR_CANCELED {
+		t.Errorf("queued commit = %v", err)
+	}
+
+	if mock.Streams() != 0 {
+		t.Errorf("cancelled commits opened %d stream(s)", mock.Streams())
+	}
+}
@@ -8,9 +8,9 @@ package main
 
 import (
 	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	"cds.ikigai.net/cabinet.v1.test/cabinet/iri"
 	pb "cds.ikigai.net/cabinet.v1/rpc"
-	"fmt"
-	"strings"
+	"errors"
 	"testing"
 )
 
@@ -29,7 +29,7 @@ func TestTransactionReadCheckNode(t *testing.T) {
 	}), &it)
 
 	n1.Id = mapIDs["tmp:1"]
-	n1IRI := fmt.Sprintf("n/%d/%s", n1.Type, n1.Id)
+	n1IRI := iri.NodeOf(n1).String()
 
 	cds := cabinet.Transaction{}
 	cds.Setup(it.ctx, it.client)
@@ -43,7 +43,7 @@ func TestTransactionReadCheckNode(t *testing.T) {
 		Action: &pb.TransactionAction_NodeUpdate{NodeUpdate: nodeWithPayload(n1, p2)},
 	})
 
-	checkTransactionFailed(&it, cds.Commit(), "E(0x013)")
+	checkTransactionFailed(&it, cds.Commit(), cabinet.ErrReadCheckFailed)
 
 	// should still have p1
 	el1, err := it.client.NodeGet(it.ctx, &pb.NodeGetRequest{NodeType: n1.Type, Id: n1.Id})
@@ -81,11 +81,58 @@ func TestTransactionReadCheckNode(t *testing.T) {
 	it.tearDown()
 }
 
-func checkTransactionFailed(it *CabinetTest, err error, code string) {
-	if err != nil && strings.Contains(err.Error(), code) {
-		it.test.Logf("Transaction was rejected with code: %s", code)
+func TestTransactionReadCheckNodeBuilder(t *testing.T) {
+	it := CabinetTest{test: t}
+	it.setup(2)
+
+	p1, p2 := MockRandomPayload(), MockRandomPayload()
+	n1 := &pb.Node{Type: uint32(MockRandomInt(1, 65000)), Version: 1, Id: "tmp:1", Properties: p1}
+
+	mapIDs := CDSTransactionRunner(&([]pb.TransactionAction{
+		{ActionId: 1, Action: &pb.TransactionAction_NodeCreate{NodeCreate: n1}},
+	}), &it)
+
+	n1.Id = mapIDs["tmp:1"]
+	n1IRI := iri.NodeOf(n1).String()
+
+	cds := cabinet.Transaction{}
+	cds.Setup(it.ctx, it.client)
+
+	cds.ReadCheck(&pb.ReadCheckRequest{
+		Source: n1IRI, Operator: pb.CheckOperators_EQUAL, Target: &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: "not good"}},
+	})
+
+	cds.NodeUpdate(nodeWithPayload(n1, p2))
+
+	checkTransactionFailed(&it, cds.Commit(), cabinet.ErrReadCheckFailed)
+
+	cds2 := cabinet.Transaction{}
+	cds2.Setup(it.ctx, it.client)
+
+	cds2.ReadCheck(&pb.ReadCheckRequest{
+		Source: n1IRI, Operator: pb.CheckOperators_EQUAL, Target: &pb.CheckTarget{Target: &pb.CheckTarget_Val{Val: string(p1)}},
+	})
+
+	h := cds2.NodeUpdate(nodeWithPayload(n1, p2))
+
+	if h.Kind() != cabinet.ACTION_NODE_UPDATE {
+		it.test.Errorf("handle kind got %s expected %s", h.Kind(), cabinet.ACTION_NODE_UPDATE)
+	}
+
+	checkTransactionSuccess(&it, cds2.Commit())
+
+	el2, err := it.client.NodeGet(it.ctx, &pb.NodeGetRequest{NodeType: n1.Type, Id: n1.Id})
+	it.logThing(el2, err, "NodeGet")
+	validatePayload(el2, &it, p2, el2.Properties)
+
+	it.tearDown()
+}
+
+func checkTransactionFailed(it *CabinetTest, err error, expected error) {
+	if errors.Is(err, expected) {
+		it.test.Logf("Transaction was rejected with: %v", expected)
 	} else {
-		it.test.Errorf("Transaction was not rejected with %s, got %v", code, err)
+		it.test.Errorf("Transaction was not rejected with %v, got %v", expected, err)
 	}
 }
 
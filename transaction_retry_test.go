@@ -0,0 +1,72 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func mockRetryPolicy(attempts int) *cabinet.RetryPolicy {
+	p := cabinet.DefaultRetryPolicy()
+	p.MaxAttempts = attempts
+	p.InitialBackoff = time.Millisecond
+
+	return p
+}
+
+func TestTransactionRetryUnavailable(t *testing.T) {
+	mock := &MockCabinet{failConnections: 2}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.SetRetryPolicy(mockRetryPolicy(3))
+	cds.EdgeUpdate(MockRandomEdge())
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	if cds.Attempts() != 3 || mock.Streams() != 3 {
+		t.Errorf("expected 3 attempts, got %d (%d streams)", cds.Attempts(), mock.Streams())
+	}
+}
+
+func TestTransactionRetryExhausted(t *testing.T) {
+	mock := &MockCabinet{failConnections: 5}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.SetRetryPolicy(mockRetryPolicy(2))
+	cds.NodeCreate(&pb.Node{Type: 1, Version: 1})
+
+	err := cds.Commit()
+
+	if !errors.Is(err, cabinet.ErrUnavailable) || !errors.Is(err, cabinet.ErrTransport) {
+		t.Errorf("expected an unavailable transport error, got %v", err)
+	}
+
+	if cds.Attempts() != 2 {
+		t.Errorf("expected 2 attempts, got %d", cds.Attempts())
+	}
+}
+
+func TestTransactionRetryDisabled(t *testing.T) {
+	mock := &MockCabinet{failConnections: 1}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.EdgeUpdate(MockRandomEdge())
+
+	if err := cds.Commit(); err == nil || cds.Attempts() != 1 {
+		t.Errorf("expected a single failed attempt, got %v after %d", err, cds.Attempts())
+	}
+}
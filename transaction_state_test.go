@@ -0,0 +1,143 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"testing"
+)
+
+func TestTransactionStateLifecycle(t *testing.T) {
+	mock := &MockCabinet{}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.NodeCreate(&pb.Node{Type: 1, Version: 1})
+	cds.EdgeUpdate(MockRandomEdge())
+
+	if cds.State() != cabinet.STATE_BUILDING {
+		t.Errorf("new transaction is %s", cds.State())
+	}
+
+	if err := cds.Commit(); err != nil || cds.State() != cabinet.STATE_COMMITTED {
+		t.Fatalf("Commit() = %v, state %s", err, cds.State())
+	}
+
+	// committed transactions are closed
+	cds.EdgeUpdate(MockRandomEdge())
+
+	if err := cds.Commit(); err == nil {
+		t.Errorf("committed transaction accepted a new action")
+	}
+
+	clone := cds.Clone()
+
+	if clone.State() != cabinet.STATE_BUILDING || len(clone.Results()) != 2 {
+		t.Errorf("clone is %s with %d actions", clone.State(), len(clone.Results()))
+	}
+
+	if err := clone.Commit(); err != nil {
+		t.Errorf("clone.Commit() = %v", err)
+	}
+
+	cds.Reset()
+	cds.EdgeUpdate(MockRandomEdge())
+
+	if err := cds.Commit(); err != nil {
+		t.Errorf("Commit() after Reset() = %v", err)
+	}
+
+	if len(mock.Commits()) != 3 {
+		t.Errorf("expected 3 commits, got %d", len(mock.Commits()))
+	}
+}
+
+func TestTransactionStateCloneOptions(t *testing.T) {
+	mock := &MockCabinet{createIDs: true}
+	sent := 0
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.SetChunking(&cabinet.ChunkPolicy{MaxActions: 1})
+	cds.SetUndo(true)
+	cds.SetOptimize(true)
+	cds.SetRetryPolicy(&cabinet.RetryPolicy{MaxAttempts: 1})
+	cds.Use(&cabinet.Hooks{BeforeSend: func(ctx context.Context, o *pb.TransactionAction) error {
+		sent += 1
+		return nil
+	}})
+
+	var out bytes.Buffer
+	cds.SetDryRun(&out)
+
+	cds.NodeCreate(&pb.Node{Type: 1, Properties: []byte("a")})
+	cds.NodeUpdate(&pb.Node{Type: 1, Id: "tmp:1", Properties: []byte("b")})
+	cds.EdgeUpdate(MockRandomEdge())
+
+	clone := cds.Clone()
+
+	if err := clone.Commit(); err != nil || out.Len() == 0 || mock.Streams() != 0 {
+		t.Fatalf("clone dry run Commit() = %v, wrote %d bytes, opened %d stream(s)", err, out.Len(), mock.Streams())
+	}
+
+	clone.SetDryRun(nil)
+
+	if err := clone.Commit(); err != nil {
+		t.Fatalf("clone Commit() = %v", err)
+	}
+
+	if report := clone.Optimized(); report == nil || report.After != 2 {
+		t.Errorf("clone was not optimized: %v", report)
+	}
+
+	if len(clone.Chunks()) != 2 || sent != 2 {
+		t.Errorf("clone sent %d action(s) in %d chunk(s), expected 2 in 2", sent, len(clone.Chunks()))
+	}
+
+	if _, err := clone.Undo(); err != nil {
+		t.Errorf("clone Undo() = %v", err)
+	}
+}
+
+func TestTransactionStateReset(t *testing.T) {
+	mock := &MockCabinet{createIDs: true}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.SetChunking(&cabinet.ChunkPolicy{MaxActions: 1})
+	cds.SetUndo(true)
+	cds.SetOptimize(true)
+
+	cds.NodeCreate(&pb.Node{Type: 1, Properties: []byte("a")})
+	cds.EdgeUpdate(MockRandomEdge())
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	cds.Reset()
+
+	if cds.Chunks() != nil || cds.Attempts() != 0 || cds.Optimized() != nil || len(cds.Results()) != 0 || len(cds.GetIdMap()) != 0 {
+		t.Errorf("Reset() kept the last commit: %d chunk(s), %d attempt(s), report %v", len(cds.Chunks()), cds.Attempts(), cds.Optimized())
+	}
+
+	cds.EdgeUpdate(MockRandomEdge())
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() after Reset() = %v", err)
+	}
+
+	// a guard and a delete of the new edge, nothing of the first commit
+	if undo, err := cds.Undo(); err != nil {
+		t.Errorf("Undo() after Reset() = %v", err)
+	} else if len(undo.Results()) != 2 {
+		t.Errorf("undo after Reset() has %d actions, expected to only delete the new edge", len(undo.Results()))
+	}
+}
@@ -0,0 +1,188 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransactionTrace(t *testing.T) {
+	exporter := &cabinet.InMemoryExporter{}
+	tracer := cabinet.NewTracer(exporter)
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), &MockCabinet{})
+	cds.Use(tracer.Hooks())
+
+	nodeID := MockRandomNodeID()
+	cds.NodeUpdate(&pb.Node{Type: 1, Id: nodeID, Properties: []byte("four")})
+	cds.CounterIncrement(&pb.Counter{Object: &pb.Counter_Node{Node: nodeID}, Counter: 3, Value: 1})
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	spans := exporter.Spans()
+
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+
+	span := spans[0]
+
+	if span.Err != nil || span.Attributes["actions"] != 2 || span.Attributes["state"] != cabinet.STATE_COMMITTED.String() || span.Duration() < 0 {
+		t.Errorf("unexpected span %+v", span)
+	}
+
+	if len(span.Events) != 2 {
+		t.Fatalf("expected an event per action, got %v", span.Events)
+	}
+
+	first := span.Events[0].Attributes
+
+	if first["kind"] != "NodeUpdate" || first["iri"] != "n/1/"+nodeID || first["payload"] != 4 {
+		t.Errorf("unexpected event %v", first)
+	}
+
+	if _, timed := first["latency"].(time.Duration); !timed {
+		t.Errorf("event %v has no latency", first)
+	}
+
+	if span.Events[1].Attributes["iri"] != "c/n/"+nodeID+"/3" {
+		t.Errorf("unexpected event %v", span.Events[1].Attributes)
+	}
+}
+
+func TestTransactionTraceInterceptor(t *testing.T) {
+	exporter := &cabinet.InMemoryExporter{}
+	tracer := cabinet.NewTracer(exporter)
+	intercept := tracer.UnaryClientInterceptor()
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if cabinet.SpanFromContext(ctx) == parent {
+			t.Errorf("invoker did not get the call span")
+		}
+
+		return status.Error(codes.NotFound, "not found")
+	}
+
+	req := &pb.NodeGetRequest{Id: MockRandomNodeID()}
+
+	if err := intercept(ctx, "/CDSCabinet/NodeGet", req, &pb.Node{}, nil, invoker); status.Code(err) != codes.NotFound {
+		t.Fatalf("interceptor returned %v", err)
+	}
+
+	spans := exporter.Spans()
+
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+
+	span := spans[0]
+
+	if span.Name != "/CDSCabinet/NodeGet" || span.TraceID != parent.TraceID || span.ParentID != parent.SpanID || span.Err == nil {
+		t.Errorf("unexpected span %+v", span)
+	}
+
+	if span.Attributes["status"] != codes.NotFound.String() {
+		t.Errorf("unexpected attributes %v", span.Attributes)
+	}
+}
+
+// abortingStream is a transaction stream whose server aborts after a few messages, while the client may
+// still be sending
+type abortingStream struct {
+	grpc.ClientStream
+
+	ctx     context.Context
+	after   int
+	mux     sync.Mutex
+	sent    int
+	aborted chan struct{}
+	once    sync.Once
+}
+
+func (s *abortingStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *abortingStream) SendMsg(m interface{}) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	select {
+	case <-s.aborted:
+		return io.EOF
+	default:
+	}
+
+	if s.sent += 1; s.sent == s.after {
+		s.once.Do(func() { close(s.aborted) })
+	}
+
+	return nil
+}
+
+func (s *abortingStream) RecvMsg(m interface{}) error {
+	<-s.aborted
+	return status.Error(codes.Aborted, "mock stream aborted")
+}
+
+func TestTransactionTraceStreamAbort(t *testing.T) {
+	exporter := &cabinet.InMemoryExporter{}
+	tracer := cabinet.NewTracer(exporter)
+	intercept := tracer.StreamClientInterceptor()
+
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &abortingStream{ctx: ctx, after: 10, aborted: make(chan struct{})}, nil
+	}
+
+	stream, err := intercept(context.Background(), &grpc.StreamDesc{}, nil, "/CDSCabinet/Transaction", streamer)
+
+	if err != nil {
+		t.Fatalf("interceptor returned %v", err)
+	}
+
+	var sender sync.WaitGroup
+	sender.Add(1)
+
+	go func() {
+		defer sender.Done()
+
+		for i := 0; i < 1000; i++ {
+			if stream.SendMsg(&pb.TransactionAction{}) == io.EOF {
+				return
+			}
+		}
+	}()
+
+	if err := stream.RecvMsg(&pb.TransactionActionResponse{}); status.Code(err) != codes.Aborted {
+		t.Errorf("RecvMsg() = %v", err)
+	}
+
+	sender.Wait()
+	spans := exporter.Spans()
+
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+
+	if span := spans[0]; span.Attributes["status"] != codes.Aborted.String() || span.Attributes["sent"].(int) < 1 || span.Err == nil {
+		t.Errorf("unexpected span %+v", span)
+	}
+}
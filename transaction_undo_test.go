@@ -0,0 +1,157 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTransactionUndo(t *testing.T) {
+	oldProps := MockRandomBytes(10)
+	nodeA := &pb.Node{Type: 1, Id: MockRandomNodeID(), Properties: oldProps}
+	edgeB := &pb.Edge{Subject: nodeA.Id, Predicate: 10, Target: MockRandomNodeID(), Properties: MockRandomBytes(10)}
+	edgeC := &pb.Edge{Subject: nodeA.Id, Predicate: 10, Target: MockRandomNodeID(), Properties: MockRandomBytes(10)}
+
+	mock := &MockCabinet{
+		nodes: map[string]*pb.Node{nodeA.Id: nodeA},
+		edges: map[string]*pb.Edge{mockEdgeKey(edgeB): edgeB},
+	}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.SetUndo(true)
+
+	newProps := MockRandomBytes(12)
+	cds.NodeUpdate(&pb.Node{Type: 1, Id: nodeA.Id, Properties: newProps})
+	cds.EdgeUpdate(edgeC)
+	cds.EdgeDelete(&pb.Edge{Subject: edgeB.Subject, Predicate: edgeB.Predicate, Target: edgeB.Target})
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	undo, err := cds.Undo()
+
+	if err != nil {
+		t.Fatalf("Undo() = %v", err)
+	}
+
+	expected := []cabinet.ActionKind{
+		cabinet.ACTION_EDGE_UPDATE,                            // edge B is restored, it no longer exists so it is not guarded
+		cabinet.ACTION_READ_CHECK, cabinet.ACTION_EDGE_DELETE, // edge C did not exist
+		cabinet.ACTION_READ_CHECK, cabinet.ACTION_NODE_UPDATE, // node A gets its old properties back
+	}
+
+	results := undo.Results()
+
+	if len(results) != len(expected) {
+		t.Fatalf("undo has %d actions, expected %d", len(results), len(expected))
+	}
+
+	for i, r := range results {
+		if r.Kind != expected[i] {
+			t.Errorf("undo action %d is %s, expected %s", i, r.Kind, expected[i])
+		}
+	}
+
+	if rc := results[3].ReadCheck(); rc.Source != fmt.Sprintf("n/1/%s", nodeA.Id) || rc.Target.GetVal() != string(newProps) {
+		t.Errorf("node guard is %v", rc)
+	}
+
+	if restored := results[4].Node(); !bytes.Equal(restored.Properties, oldProps) {
+		t.Errorf("node restored with %v, expected %v", restored.Properties, oldProps)
+	}
+
+	if err := undo.Commit(); err != nil {
+		t.Errorf("undo Commit() = %v", err)
+	}
+}
+
+// TestTransactionUndoPayloadOnly restores objects read from a server that does not echo their keys
+func TestTransactionUndoPayloadOnly(t *testing.T) {
+	nodeA := &pb.Node{Type: 1, Id: MockRandomNodeID(), Properties: MockRandomBytes(10)}
+	edgeB := &pb.Edge{Subject: nodeA.Id, Predicate: 10, Target: MockRandomNodeID(), Properties: MockRandomBytes(10)}
+
+	mock := &MockCabinet{
+		nodes:       map[string]*pb.Node{nodeA.Id: {Type: nodeA.Type, Id: nodeA.Id, Properties: nodeA.Properties}},
+		edges:       map[string]*pb.Edge{mockEdgeKey(edgeB): edgeB},
+		payloadOnly: true,
+	}
+
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), mock)
+	cds.SetUndo(true)
+
+	cds.NodeUpdate(&pb.Node{Type: nodeA.Type, Id: nodeA.Id, Properties: MockRandomBytes(10)})
+	cds.EdgeDelete(&pb.Edge{Subject: edgeB.Subject, Predicate: edgeB.Predicate, Target: edgeB.Target})
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	undo, err := cds.Undo()
+
+	if err != nil {
+		t.Fatalf("Undo() = %v", err)
+	}
+
+	results := undo.Results()
+
+	if len(results) != 3 {
+		t.Fatalf("undo has %d actions, expected 3", len(results))
+	}
+
+	if e := results[0].Edge(); e.Subject != edgeB.Subject || e.Predicate != edgeB.Predicate || e.Target != edgeB.Target || !bytes.Equal(e.Properties, edgeB.Properties) {
+		t.Errorf("edge restored as %v, expected %v", e, edgeB)
+	}
+
+	if n := results[2].Node(); n.Type != nodeA.Type || n.Id != nodeA.Id || !bytes.Equal(n.Properties, nodeA.Properties) {
+		t.Errorf("node restored as %v, expected %v", n, nodeA)
+	}
+
+	if err := undo.Validate(); err != nil {
+		t.Errorf("undo Validate() = %v", err)
+	}
+}
+
+func TestTransactionUndoRejected(t *testing.T) {
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), &MockCabinet{})
+
+	cds.EdgeClear(&pb.Edge{Subject: MockRandomNodeID(), Predicate: 10, Target: cabinet.WILDCARD})
+
+	if err := cds.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	if _, err := cds.Undo(); err == nil {
+		t.Errorf("Undo() without SetUndo(true) was accepted")
+	}
+
+	clone := cds.Clone()
+	clone.SetUndo(true)
+
+	var trxErr *cabinet.TransactionError
+	if err := clone.Commit(); !errors.As(err, &trxErr) || trxErr.Class() != cabinet.TRANSACTION_ERROR_UNDO {
+		t.Errorf("expected EdgeClear to be rejected with undo enabled, got %v", err)
+	}
+
+	deleted := cabinet.Transaction{}
+	deleted.Setup(context.Background(), &MockCabinet{})
+	deleted.SetUndo(true)
+	deleted.NodeDelete(&pb.Node{Type: 1, Id: MockRandomNodeID()})
+
+	if err := deleted.Commit(); !errors.As(err, &trxErr) || trxErr.Class() != cabinet.TRANSACTION_ERROR_UNDO {
+		t.Errorf("expected the NodeDelete of an existing node to be rejected with undo enabled, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Package: net.ikigai.cds
+// Module: cabinet.services.test
+//
+// Author: Narcis M. PAP
+// Copyright (c) 2018 Ikigai Cloud. All rights reserved.
+
+package main
+
+import (
+	"cds.ikigai.net/cabinet.v1.test/cabinet"
+	pb "cds.ikigai.net/cabinet.v1/rpc"
+	"context"
+	"errors"
+	"testing"
+)
+
+// validation happens before the stream is opened, so no server is needed
+
+func TestTransactionValidateReportsAll(t *testing.T) {
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), nil)
+
+	cds.NodeCreate(&pb.Node{Type: 1, Version: 1, Id: "tmp:1"})
+	cds.NodeUpdate(&pb.Node{Id: "tmp:1"})                                                 // 2: missing type
+	cds.EdgeUpdate(&pb.Edge{Subject: "tmp:1", Predicate: 10, Target: "*"})                // 3: wildcard
+	cds.IndexCreate(&pb.Index{Type: 5, Node: "not-a-ksuid", Value: "cats"})               // 4: malformed KSUID
+	cds.MetaUpdate(&pb.Meta{Object: &pb.Meta_Node{Node: "tmp:2"}, Key: 7})                // 5: unknown tmp
+	cds.EdgeClear(&pb.Edge{Subject: MockRandomNodeID(), Predicate: 10, Target: "*"})      // valid
+	cds.MetaClear(&pb.Meta{Object: &pb.Meta_Node{Node: MockRandomNodeID()}})              // valid
+	cds.CounterIncrement(&pb.Counter{Object: &pb.Counter_Node{Node: MockRandomNodeID()}}) // 8: missing counter
+
+	err := cds.Commit()
+
+	var vErr *cabinet.ValidationError
+	if !errors.As(err, &vErr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+
+	expected := []uint32{2, 3, 4, 5, 8}
+	got := vErr.ActionIDs()
+
+	if len(got) != len(expected) {
+		t.Fatalf("invalid actions got %v expected %v (%v)", got, expected, err)
+	}
+
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("invalid actions got %v expected %v", got, expected)
+			break
+		}
+	}
+
+	t.Logf("Transaction was rejected: %v", err)
+}
+
+func TestTransactionValidateDuplicateTmp(t *testing.T) {
+	cds := cabinet.Transaction{}
+	cds.Setup(context.Background(), nil)
+
+	cds.NodeCreate(&pb.Node{Type: 1, Version: 1, Id: "tmp:1"})
+	cds.NodeCreate(&pb.Node{Type: 1, Version: 1, Id: "tmp:1"})
+
+	if err := cds.Validate(); err == nil {
+		t.Errorf("duplicate temporary IDs were accepted")
+	}
+}